@@ -1,38 +1,152 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
+	"github.com/hamza72x/brewc/pkg/brew"
+	"github.com/hamza72x/brewc/pkg/brewc"
 	"github.com/hamza72x/brewc/pkg/constant"
 	"github.com/hamza72x/brewc/pkg/models"
+	"github.com/hamza72x/brewc/pkg/retry"
+	col "github.com/hamza72x/go-color"
 	"github.com/spf13/cobra"
 )
 
 // _args holds the optional arguments passed to the command line.
 var _args = &models.OptionalArgs{}
 
+// _platform is the platform of the bottles, detected or set with --platform
+var _platform *models.ArchAndCodeName
+
+// _detector detects the platform brewc is running on.
+var _detector models.PlatformDetector = models.SystemPlatform{}
+
+// _brew is the brew binary validated with --ask-brew, nil otherwise, see brewc.New
+var _brew *brew.Brew
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "brewc",
 	Short: "Install brew packages with concurrent downloads instead of one by one (which is typically slow)",
 	Run:   runRootCmd,
+
+	// runs before every command, after the flags are parsed.
+	PersistentPreRunE: initialize,
+
+	// the usage is not printed when a command fails while running.
+	SilenceUsage: true,
+}
+
+func init() {
+	policy := retry.DefaultPolicy()
+
+	rootCmd.PersistentFlags().StringVar(&_args.Platform, "platform", "", "bottle tag of the platform to use instead of the detected one, example: arm64_sonoma")
+	rootCmd.PersistentFlags().StringVar(&_args.Brew, "brew", "", "path of the brew binary (default: HOMEBREW_BREW_FILE, PATH or the default prefixes)")
+	rootCmd.PersistentFlags().BoolVar(&_args.AskBrew, "ask-brew", false, "ask brew for its prefix and cache (brew --prefix, brew --cache) when HOMEBREW_PREFIX and HOMEBREW_CACHE are not set")
+	rootCmd.PersistentFlags().BoolVar(&_args.FormulaIndex, "formula-index", false, "download the full formula index once and cache it, instead of one request per formula")
+	rootCmd.PersistentFlags().BoolVar(&_args.Offline, "offline", false, "resolve and install only from the local caches, and list what's missing from them")
+	rootCmd.PersistentFlags().IntVar(&_args.RetryAttempts, "retry-attempts", policy.Attempts, "maximum number of attempts of a network request")
+	rootCmd.PersistentFlags().DurationVar(&_args.RetryBackoff, "retry-backoff", policy.Backoff, "base wait between the attempts of a network request, it grows exponentially")
+	rootCmd.PersistentFlags().DurationVar(&_args.RetryMaxElapsed, "retry-max-elapsed", policy.MaxElapsed, "stop retrying a network request once it took this long (0 means no limit)")
+	rootCmd.PersistentFlags().DurationVar(&_args.RetryTimeout, "retry-timeout", policy.Timeout, "timeout of a single attempt of a formula request, not of the bottle downloads (0 means no limit)")
 }
 
 // Run executes the root command.
 func Run() {
-	archAndCodeName := models.GetArchAndOSName()
+	err := rootCmd.Execute()
 
-	constant.Initialize(archAndCodeName.Architecture)
+	var exitErr *exitError
 
-	err := rootCmd.Execute()
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
 
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 }
 
+// initialize detects the platform and sets the brew directories, see constant.Initialize
+func initialize(cmd *cobra.Command, args []string) error {
+	archAndCodeName, err := _detector.Detect()
+
+	if err != nil {
+		return err
+	}
+
+	_platform = archAndCodeName
+
+	if len(_args.Platform) > 0 {
+		if _platform, err = models.ParsePlatform(_args.Platform); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s\n", col.Green("Platform"), _platform.Name())
+
+	var brewBin string
+
+	if _args.AskBrew {
+		if _brew, err = brew.New(_args.Brew); err != nil {
+			return err
+		}
+
+		brewBin = _brew.Bin()
+	}
+
+	return constant.Initialize(archAndCodeName.Architecture, brewBin)
+}
+
 // rootCmd represents the base command when called without any subcommands
 // only used to print the usage.
 func runRootCmd(cmd *cobra.Command, args []string) {
 	cmd.Usage()
 }
+
+// exit codes of the commands
+const (
+	exitSuccess = 0
+
+	// exitFailure means none of the requested formulae succeeded
+	exitFailure = 1
+
+	// exitPartialFailure means some of the formulae failed, and some of the requested ones succeeded
+	exitPartialFailure = 2
+)
+
+// exitError is returned by a command to exit with a specific code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// finish prints the summary of a command and returns its exit error, nil on success.
+// Only the formulae brew ran for count, see Summary.Outcome: the command fails
+// if none of them (or none of the requested ones) succeeded, and partially fails if some of them did.
+func finish(summary *brewc.Summary, command string) error {
+	fmt.Println("")
+	summary.Print(os.Stdout)
+
+	succeeded, failed, requested := summary.Outcome()
+
+	if failed == 0 {
+		return nil
+	}
+
+	code := exitPartialFailure
+
+	if succeeded == 0 || requested == 0 {
+		code = exitFailure
+	}
+
+	return &exitError{
+		code: code,
+		err:  fmt.Errorf("%s failed for %d of %d formulae", command, failed, succeeded+failed),
+	}
+}
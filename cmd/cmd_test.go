@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models"
+)
+
+// useDetector replaces the platform detector and the --platform flag for the test.
+func useDetector(t *testing.T, detector models.PlatformDetector, platform string) {
+	t.Helper()
+
+	t.Setenv("HOMEBREW_CACHE", t.TempDir())
+
+	oldDetector, oldPlatform := _detector, _args.Platform
+
+	t.Cleanup(func() {
+		_detector, _args.Platform, _platform = oldDetector, oldPlatform, nil
+	})
+
+	_detector, _args.Platform = detector, platform
+}
+
+func TestInitializePlatform(t *testing.T) {
+	tests := []struct {
+		name     string
+		detected *models.ArchAndCodeName
+		platform string
+		want     string
+	}{
+		{"apple silicon", &models.ArchAndCodeName{Architecture: models.Arm64, CodeName: models.Sonoma}, "", "arm64_sonoma"},
+		{"intel", &models.ArchAndCodeName{Architecture: models.X86_64, CodeName: models.Monterey}, "", "monterey"},
+		{"linux", &models.ArchAndCodeName{Architecture: models.X86_64, CodeName: models.Linux}, "", "x86_64_linux"},
+		{"--platform", &models.ArchAndCodeName{Architecture: models.Arm64, CodeName: models.Sonoma}, "x86_64_linux", "x86_64_linux"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useDetector(t, &models.FakePlatform{Platform: tt.detected}, tt.platform)
+
+			if err := initialize(rootCmd, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := _platform.Name(); got != tt.want {
+				t.Fatalf("platform is %s, want %s", got, tt.want)
+			}
+
+			if len(constant.Get().DirDownloads) == 0 {
+				t.Fatal("the brew directories are not set")
+			}
+		})
+	}
+}
+
+func TestInitializeUnknownMacOS(t *testing.T) {
+	detectErr := errors.New("unknown macOS version: 9.0")
+
+	useDetector(t, &models.FakePlatform{Err: detectErr}, "")
+
+	if err := initialize(rootCmd, nil); !errors.Is(err, detectErr) {
+		t.Fatalf("expected the detection error, got %v", err)
+	}
+
+	if _platform != nil {
+		t.Fatalf("platform is set to %s", _platform.Name())
+	}
+}
+
+func TestInitializeInvalidPlatform(t *testing.T) {
+	useDetector(t, &models.FakePlatform{Platform: &models.ArchAndCodeName{Architecture: models.Arm64, CodeName: models.Sonoma}}, "arm64_windows")
+
+	if err := initialize(rootCmd, nil); err == nil {
+		t.Fatalf("expected an error for --platform arm64_windows, got %s", _platform.Name())
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hamza72x/brewc/pkg/brewc"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+	"github.com/spf13/cobra"
+)
+
+// depsCmd represents the deps command
+var depsCmd = &cobra.Command{
+	Use:   "deps",
+	Short: "print the dependencies of a formula",
+	Example: `brewc deps ffmpeg # as a tree
+brewc deps --format flat --annotate ffmpeg # in install order, with the installed and missing ones
+brewc deps --format dot --include-build ffmpeg | dot -Tsvg > ffmpeg.svg
+brewc deps --format json --depth 1 ffmpeg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runDepsCmd,
+}
+
+func init() {
+	depsCmd.Flags().IntVarP(&_args.Threads, "threads", "t", 10, "number of threads to use for resolving the formulae")
+	depsCmd.Flags().BoolVar(&_args.KeepGoing, "keep-going", false, "print the resolved formulae when some of the dependencies couldn't be resolved")
+	depsCmd.Flags().StringVarP(&_args.Format, "format", "f", "", "output format: tree, flat, dot or json (default: tree)")
+	depsCmd.Flags().IntVar(&_args.Depth, "depth", 0, "depth of the dependencies, 1 means only the direct ones (default: all of them)")
+	depsCmd.Flags().BoolVar(&_args.Annotate, "annotate", false, "print the install state of every formula: installed, outdated or missing")
+	depsCmd.Flags().BoolVar(&_args.IncludeBuild, "include-build", false, "include the build dependencies")
+	depsCmd.Flags().BoolVar(&_args.IncludeTest, "include-test", false, "include the test dependencies")
+	depsCmd.Flags().BoolVar(&_args.IncludeOptional, "include-optional", false, "include the optional dependencies")
+	depsCmd.Flags().BoolVar(&_args.SkipRecommended, "skip-recommended", false, "leave out the recommended dependencies")
+
+	rootCmd.AddCommand(depsCmd)
+}
+
+// runDepsCmd executes the deps command.
+// Example: brewc deps ffmpeg
+func runDepsCmd(cmd *cobra.Command, args []string) error {
+
+	write, err := getDepsWriter(_args.Format)
+
+	if err != nil {
+		return err
+	}
+
+	brewc := brewc.NewFetcher(_args, _platform)
+
+	opts := &formula.WriteOpts{
+		Annotate: _args.Annotate,
+	}
+
+	for _, name := range args {
+		list, err := brewc.GetDeps(name, _args.Depth)
+
+		if err != nil {
+			return err
+		}
+
+		if err := write(list, os.Stdout, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getDepsWriter returns the FormulaList method writing the given format.
+func getDepsWriter(format string) (func(*formula.FormulaList, io.Writer, *formula.WriteOpts) error, error) {
+	switch format {
+	case "", "tree":
+		return (*formula.FormulaList).WriteTree, nil
+	case "flat":
+		return (*formula.FormulaList).WriteFlat, nil
+	case "dot":
+		return (*formula.FormulaList).WriteDOT, nil
+	case "json":
+		return (*formula.FormulaList).WriteJSON, nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s (tree, flat, dot or json)", format)
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hamza72x/brewc/pkg/brewc"
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/registry"
+	col "github.com/hamza72x/go-color"
+	"github.com/spf13/cobra"
+)
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "download the bottles of a formula and its dependencies, without installing them",
+	Example: `brewc fetch ffmpeg # into brew's cache, for this machine
+brewc fetch --bottle-tag arm64_sonoma --dir ./cache ffmpeg # for another machine, then: rsync -a ./cache/ mac:~/Library/Caches/Homebrew/`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runFetchCmd,
+}
+
+func init() {
+	fetchCmd.Flags().IntVarP(&_args.Threads, "threads", "t", 10, "number of threads to use for downloading the formulae")
+	fetchCmd.Flags().BoolVarP(&_args.Verbose, "verbose", "v", false, "verbose output")
+	fetchCmd.Flags().BoolVar(&_args.KeepGoing, "keep-going", false, "continue with the resolved formulae when some of the dependencies couldn't be resolved")
+	fetchCmd.Flags().StringVar(&_args.RegistryURL, "registry-url", registry.DefaultBaseURL, "base url of the registry to download the bottles from")
+	fetchCmd.Flags().StringVar(&_args.Platform, "bottle-tag", "", "bottle tag of the target platform, the same as --platform, example: arm64_sonoma")
+	fetchCmd.Flags().StringVar(&_args.FetchDir, "dir", "", "directory to download into, laid out like brew's cache (default: brew's cache)")
+	fetchCmd.Flags().BoolVar(&_args.IncludeBuild, "include-build", false, "include the build dependencies, example: for --build-from-source installs")
+	fetchCmd.Flags().BoolVar(&_args.IncludeTest, "include-test", false, "include the test dependencies")
+	fetchCmd.Flags().BoolVar(&_args.IncludeOptional, "include-optional", false, "include the optional dependencies")
+	fetchCmd.Flags().BoolVar(&_args.SkipRecommended, "skip-recommended", false, "leave out the recommended dependencies")
+
+	rootCmd.AddCommand(fetchCmd)
+}
+
+// runFetchCmd executes the fetch command.
+// Example: brewc fetch --bottle-tag arm64_sonoma ffmpeg
+func runFetchCmd(cmd *cobra.Command, args []string) error {
+
+	if len(_args.FetchDir) > 0 {
+		if err := constant.SetCaches(_args.FetchDir); err != nil {
+			return err
+		}
+	}
+
+	brewc := brewc.NewFetcher(_args, _platform)
+
+	for _, name := range args {
+		fmt.Println("<<<<<<<<<<<< fetching", col.Magenta(name), " >>>>>>>>>>>>")
+		err := brewc.FetchFormula(name)
+
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	return finish(brewc.Summary(), "fetch")
+}
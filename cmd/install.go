@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/hamza72x/brewc/pkg/brewc"
+	"github.com/hamza72x/brewc/pkg/registry"
 	col "github.com/hamza72x/go-color"
 	"github.com/spf13/cobra"
 )
@@ -15,21 +16,33 @@ var installCmd = &cobra.Command{
 	Example: `brewc install ffmpeg # for single formulae
 brewc install ffmpeg git wget curl # for multiple formulae`,
 	Args: cobra.MinimumNArgs(1),
-	Run:  runInstallCmd,
+	RunE: runInstallCmd,
 }
 
 func init() {
 	installCmd.Flags().IntVarP(&_args.Threads, "threads", "t", 10, "number of threads to use for downloading the formulae")
 	installCmd.Flags().BoolVarP(&_args.Verbose, "verbose", "v", false, "verbose output")
+	installCmd.Flags().BoolVar(&_args.KeepGoing, "keep-going", false, "continue with the resolved formulae when some of the dependencies couldn't be resolved")
+	installCmd.Flags().StringVar(&_args.RegistryURL, "registry-url", registry.DefaultBaseURL, "base url of the registry to download the bottles from")
+	installCmd.Flags().BoolVar(&_args.IncludeBuild, "include-build", false, "include the build dependencies, example: for --build-from-source installs")
+	installCmd.Flags().BoolVar(&_args.IncludeTest, "include-test", false, "include the test dependencies")
+	installCmd.Flags().BoolVar(&_args.IncludeOptional, "include-optional", false, "include the optional dependencies")
+	installCmd.Flags().BoolVar(&_args.SkipRecommended, "skip-recommended", false, "leave out the recommended dependencies")
 
 	rootCmd.AddCommand(installCmd)
 }
 
 // runInstallCmd executes the install command.
 // Example: brewc install ffmpeg
-func runInstallCmd(cmd *cobra.Command, args []string) {
+func runInstallCmd(cmd *cobra.Command, args []string) error {
 
-	brewc := brewc.New(_args)
+	brewc, err := brewc.New(_args, _platform, _brew)
+
+	if err != nil {
+		return err
+	}
+
+	brewc.SetRequested(args)
 
 	for _, name := range args {
 		fmt.Println("<<<<<<<<<<<< installing", col.Magenta(name), " >>>>>>>>>>>>")
@@ -39,4 +52,6 @@ func runInstallCmd(cmd *cobra.Command, args []string) {
 			fmt.Println("Error:", err)
 		}
 	}
+
+	return finish(brewc.Summary(), "install")
 }
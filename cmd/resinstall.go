@@ -15,7 +15,7 @@ var reinstallCmd = &cobra.Command{
 	Example: `brewc reinstall ffmpeg # for single formulae
 brewc reinstall ffmpeg git wget curl # for multiple formulae`,
 	Args: cobra.MinimumNArgs(1),
-	Run:  runReinstallCmd,
+	RunE: runReinstallCmd,
 }
 
 func init() {
@@ -28,9 +28,13 @@ func init() {
 
 // runReinstallCmd executes the reinstall command.
 // Example: brewc reinstall ffmpeg
-func runReinstallCmd(cmd *cobra.Command, args []string) {
+func runReinstallCmd(cmd *cobra.Command, args []string) error {
 
-	brewc := brewc.New(_args)
+	brewc, err := brewc.New(_args, _platform, _brew)
+
+	if err != nil {
+		return err
+	}
 
 	for _, name := range args {
 		fmt.Println("<<<<<<<<<<<< reinstalling", col.Magenta(name), " >>>>>>>>>>>>")
@@ -40,4 +44,6 @@ func runReinstallCmd(cmd *cobra.Command, args []string) {
 			fmt.Println("Error:", err)
 		}
 	}
+
+	return finish(brewc.Summary(), "reinstall")
 }
@@ -15,7 +15,7 @@ var uninstallCmd = &cobra.Command{
 	Example: `brewc uninstall ffmpeg # for single formulae
 brewc uninstall ffmpeg git wget curl # for multiple formulae`,
 	Args: cobra.MinimumNArgs(1),
-	Run:  runUninstallCmd,
+	RunE: runUninstallCmd,
 }
 
 func init() {
@@ -23,15 +23,19 @@ func init() {
 
 	uninstallCmd.Flags().IntVarP(&_args.Threads, "threads", "t", 10, "number of threads to use for downloading the formulae")
 	uninstallCmd.Flags().BoolVarP(&_args.Verbose, "verbose", "v", false, "verbose output")
-	uninstallCmd.Flags().BoolVarP(&_args.DeleteUnusedDependencies, "delete-unused-dependencies", "d", false, "delete unused dependencies after uninstalling a formula")
-	uninstallCmd.Flags().BoolVarP(&_args.DeleteAllNestedDependencies, "delete-all-nested-dependencies", "D", false, "delete all sub-dependencies after uninstalling a formula (it will delete all nested unused dependencies)")
+	uninstallCmd.Flags().BoolVarP(&_args.DeleteUnusedDependencies, "delete-unused-dependencies", "d", false, "delete the dependencies no other installed formula needs after uninstalling a formula")
+	uninstallCmd.Flags().BoolVarP(&_args.DeleteAllNestedDependencies, "delete-all-nested-dependencies", "D", false, "delete the nested dependencies no other installed formula needs after uninstalling a formula")
 }
 
 // runUninstallCmd executes the uninstall command.
 // Example: brewc uninstall ffmpeg
-func runUninstallCmd(cmd *cobra.Command, args []string) {
+func runUninstallCmd(cmd *cobra.Command, args []string) error {
 
-	brewc := brewc.New(_args)
+	brewc, err := brewc.New(_args, _platform, _brew)
+
+	if err != nil {
+		return err
+	}
 
 	for _, name := range args {
 		fmt.Println("<<<<<<<<<<<< uninstalling", col.Magenta(name), " >>>>>>>>>>>>")
@@ -41,4 +45,6 @@ func runUninstallCmd(cmd *cobra.Command, args []string) {
 			fmt.Println("Error:", err)
 		}
 	}
+
+	return finish(brewc.Summary(), "uninstall")
 }
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hamza72x/brewc/pkg/brewc"
+	"github.com/spf13/cobra"
+)
+
+// usesCmd represents the uses command
+var usesCmd = &cobra.Command{
+	Use:   "uses",
+	Short: "print the installed formulae depending on a formula",
+	Example: `brewc uses x265 # the ones depending on it directly
+brewc uses --recursive --format json x265`,
+	Args: cobra.ExactArgs(1),
+	RunE: runUsesCmd,
+}
+
+func init() {
+	usesCmd.Flags().IntVarP(&_args.Threads, "threads", "t", 10, "number of threads to use for fetching the formulae without an install receipt")
+	usesCmd.Flags().BoolVarP(&_args.Recursive, "recursive", "r", false, "include the formulae depending on it through other formulae")
+	usesCmd.Flags().StringVarP(&_args.Format, "format", "f", "", "output format: list or json (default: list)")
+
+	rootCmd.AddCommand(usesCmd)
+}
+
+// runUsesCmd executes the uses command.
+// Example: brewc uses x265
+func runUsesCmd(cmd *cobra.Command, args []string) error {
+
+	write := brewc.WriteUses
+
+	switch _args.Format {
+	case "", "list":
+	case "json":
+		write = brewc.WriteUsesJSON
+	default:
+		return fmt.Errorf("unknown format: %s (list or json)", _args.Format)
+	}
+
+	brewc := brewc.NewFetcher(_args, _platform)
+
+	return write(os.Stdout, brewc.GetUses(args[0], _args.Recursive))
+}
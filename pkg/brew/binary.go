@@ -0,0 +1,88 @@
+package brew
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hamza72x/brewc/pkg/util"
+)
+
+// NotFoundError is returned when the brew binary isn't found in any of the tried paths.
+type NotFoundError struct {
+	Tried []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("brew binary not found, tried: HOMEBREW_BREW_FILE, PATH, %s", strings.Join(e.Tried, ", "))
+}
+
+// InvalidBinaryError is returned when `brew --version` fails, or doesn't look like brew.
+type InvalidBinaryError struct {
+	Bin string
+	Err error
+}
+
+func (e *InvalidBinaryError) Error() string {
+	return fmt.Sprintf("invalid brew binary %s: %s", e.Bin, e.Err.Error())
+}
+
+func (e *InvalidBinaryError) Unwrap() error {
+	return e.Err
+}
+
+// FindBinary returns the path to the brew binary, looked up in this order:
+// HOMEBREW_BREW_FILE, PATH, $HOMEBREW_PREFIX/bin/brew and the default prefixes.
+func FindBinary() (string, error) {
+	if bin := os.Getenv("HOMEBREW_BREW_FILE"); len(bin) > 0 && util.DoesFileExist(bin) {
+		return bin, nil
+	}
+
+	if bin, err := exec.LookPath("brew"); err == nil {
+		return bin, nil
+	}
+
+	var paths []string
+
+	if prefix := os.Getenv("HOMEBREW_PREFIX"); len(prefix) > 0 {
+		paths = append(paths, filepath.Join(prefix, "bin", "brew"))
+	}
+
+	paths = append(paths,
+		"/opt/homebrew/bin/brew",
+		"/usr/local/bin/brew",
+		"/home/linuxbrew/.linuxbrew/bin/brew",
+	)
+
+	if dirHome, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(dirHome, ".linuxbrew", "bin", "brew"))
+	}
+
+	for _, path := range paths {
+		if util.DoesFileExist(path) {
+			return path, nil
+		}
+	}
+
+	return "", &NotFoundError{Tried: paths}
+}
+
+// validateBinary makes sure the given binary is brew, by running `brew --version`.
+// example output: Homebrew 4.0.10
+func validateBinary(bin string) error {
+	out, err := util.Exec(bin, "--version")
+
+	if err != nil {
+		return &InvalidBinaryError{Bin: bin, Err: err}
+	}
+
+	firstLine := strings.SplitN(strings.TrimSpace(out), "\n", 2)[0]
+
+	if !strings.HasPrefix(firstLine, "Homebrew") {
+		return &InvalidBinaryError{Bin: bin, Err: fmt.Errorf("unexpected --version output: %q", firstLine)}
+	}
+
+	return nil
+}
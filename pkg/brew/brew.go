@@ -1,20 +1,35 @@
 package brew
 
 import (
-	"fmt"
-
 	"github.com/hamza72x/brewc/pkg/util"
-	col "github.com/hamza72x/go-color"
 )
 
 type Brew struct {
 	bin string
+
+	// env is added to the environment of the brew commands, example: HOMEBREW_NO_AUTO_UPDATE=1
+	env []string
 }
 
-func New() *Brew {
-	return &Brew{
-		bin: getBrewBinary(),
+// New returns a new Brew instance for the given brew binary.
+// If bin is empty, the binary is looked up, see FindBinary.
+// The binary is validated by running `brew --version`.
+func New(bin string) (*Brew, error) {
+	var err error
+
+	if len(bin) == 0 {
+		if bin, err = FindBinary(); err != nil {
+			return nil, err
+		}
 	}
+
+	if err := validateBinary(bin); err != nil {
+		return nil, err
+	}
+
+	return &Brew{
+		bin: bin,
+	}, nil
 }
 
 // InstallFormula installs the given formula.
@@ -28,6 +43,13 @@ func (b *Brew) InstallFormula(name string, verbose bool) error {
 	return b.Exec(args...)
 }
 
+// MarkAsDependency marks the installed formula as not installed on request,
+// so that `brew autoremove` and `brewc uninstall -d` can remove it once nothing needs it.
+// example: brew tab --no-installed-on-request libpng
+func (b *Brew) MarkAsDependency(name string) error {
+	return b.Exec("tab", "--no-installed-on-request", name)
+}
+
 // UninstallFormula uninstalls the given formula.
 func (b *Brew) UninstallFormula(name string, verbose bool) error {
 	var args = []string{"uninstall", name}
@@ -50,34 +72,17 @@ func (b *Brew) ReinstallFormula(name string, verbose bool) error {
 	return b.Exec(args...)
 }
 
-func (b *Brew) Exec(args ...string) error {
-	return util.ExecStandard(b.bin, args...)
+// Bin returns the path of the brew binary.
+func (b *Brew) Bin() string {
+	return b.bin
 }
 
-// getBrewBinary returns the path to the brew binary.
-func getBrewBinary() string {
-	var bin string
-
-	var paths = []string{
-		"/usr/local/bin/brew",
-		"/opt/homebrew/bin/brew",
-		"/home/linuxbrew/.linuxbrew/bin/brew",
-	}
-
-	for _, path := range paths {
-		if util.DoesFileExist(path) {
-			bin = path
-			break
-		}
-	}
-
-	if len(bin) == 0 {
-		fmt.Printf("brew binary not found in any of the following paths: %+v", paths)
-		// FIXME: exit with error
-		// os.Exit(1)
-	}
-
-	fmt.Printf("%s: %s\n", col.Green("Brew Binary"), bin)
+// SetEnv adds the given variables to the environment of the brew commands.
+// example: SetEnv("HOMEBREW_NO_AUTO_UPDATE=1")
+func (b *Brew) SetEnv(env ...string) {
+	b.env = append(b.env, env...)
+}
 
-	return bin
+func (b *Brew) Exec(args ...string) error {
+	return util.ExecStandardWithEnv(b.env, b.bin, args...)
 }
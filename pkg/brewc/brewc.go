@@ -1,14 +1,24 @@
 package brewc
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/hamza72x/brewc/pkg/brew"
+	"github.com/hamza72x/brewc/pkg/cellar"
 	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/downloader"
 	"github.com/hamza72x/brewc/pkg/models"
 	"github.com/hamza72x/brewc/pkg/models/formula"
+	"github.com/hamza72x/brewc/pkg/registry"
+	"github.com/hamza72x/brewc/pkg/retry"
+	"github.com/hamza72x/brewc/pkg/util"
+	col "github.com/hamza72x/go-color"
 )
 
 // BrewC downloads all of the dependencies for a formula in concurrent goroutines.
@@ -26,92 +36,433 @@ type BrewC struct {
 	// brew is the brew command wrapper
 	brew *brew.Brew
 
+	// downloader downloads the bottles into brew's cache before installing.
+	downloader *downloader.Downloader
+
 	args *models.OptionalArgs
+
+	// summary collects the result of every formula
+	summary *Summary
+
+	// key string: short name of a formula named on the command line, see SetRequested
+	requested map[string]bool
+}
+
+// New returns a new BrewC instance, for the bottles of the given platform.
+// brewBin is the brew binary if it's already validated, if it's nil the binary is looked up and validated, see brew.New
+// An error is returned if the brew binary is missing or invalid.
+func New(args *models.OptionalArgs, platform *models.ArchAndCodeName, brewBin *brew.Brew) (*BrewC, error) {
+	var err error
+
+	if brewBin == nil {
+		if brewBin, err = brew.New(args.Brew); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.Verbose {
+		fmt.Printf("%s: %s\n", col.Green("Brew Binary"), brewBin.Bin())
+	}
+
+	if args.Offline {
+		brewBin.SetEnv("HOMEBREW_NO_AUTO_UPDATE=1")
+	}
+
+	b := NewFetcher(args, platform)
+	b.brew = brewBin
+
+	return b, nil
 }
 
-// New returns a new BrewC instance.
-func New(args *models.OptionalArgs) *BrewC {
-	archAndCodeName := models.GetArchAndOSName()
+// NewFetcher returns a new BrewC instance that only downloads the bottles of the given platform,
+// see FetchFormula. It doesn't need the brew binary, example: on a server building a bottle cache.
+// The messages about the formula index are printed on stderr, so that the output of deps and uses can be piped.
+func NewFetcher(args *models.OptionalArgs, platform *models.ArchAndCodeName) *BrewC {
+	policy := &retry.Policy{
+		Attempts:   args.RetryAttempts,
+		Backoff:    args.RetryBackoff,
+		MaxBackoff: retry.DefaultPolicy().MaxBackoff,
+		MaxElapsed: args.RetryMaxElapsed,
+		Timeout:    args.RetryTimeout,
+	}
+
+	formula.SetRetryPolicy(policy)
+	formula.SetOffline(args.Offline)
+
+	if args.Offline {
+		// the index of a previous --formula-index run, if there is one.
+		if util.DoesFileExist(formula.GetIndexPath()) {
+			if idx, err := formula.ReadIndex(formula.GetIndexPath()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s\n", constant.RedArrow, err.Error())
+			} else {
+				formula.UseIndex(idx)
+			}
+		}
+	} else if args.FormulaIndex {
+		if idx, err := formula.LoadIndex(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s Error loading the formula index, falling back to single requests: %s\n", constant.RedArrow, err.Error())
+		} else {
+			formula.UseIndex(idx)
+		}
+	}
+
+	registryClient := registry.New(args.RegistryURL, &http.Client{
+		// bottles can be hundreds of megabytes, so there is no overall timeout.
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+	})
 
 	return &BrewC{
 		threads:         args.Threads,
-		archAndCodeName: archAndCodeName,
+		archAndCodeName: platform,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		brew: brew.New(),
-		args: args,
+		downloader: downloader.New(args.Threads, platform.Name(), args.Verbose, registryClient, policy),
+		args:       args,
+		summary:    newSummary(),
+		requested:  make(map[string]bool),
 	}
 }
 
+// SetRequested records the formulae named on the command line,
+// InstallFormula doesn't mark them as dependencies when another one of them depends on them.
+func (b *BrewC) SetRequested(names []string) {
+	for _, name := range names {
+		b.requested[cellar.GetShortName(name)] = true
+	}
+}
+
+// Summary returns the results of every formula handled so far.
+func (b *BrewC) Summary() *Summary {
+	return b.summary
+}
+
 // InstallFormula installs the given formula.
 // Example: InstallFormula("ffmpeg")
 func (b *BrewC) InstallFormula(name string) error {
 
+	// the previous formulae may have installed some of the dependencies.
+	cellar.Reload()
+
 	list, err := formula.GetFormulaList(name, &formula.GetFormulaListOpts{
 		IncludeInstalled: false,
 		DependencyLevel:  -1,
 		Threads:          b.threads,
-		Unique:           true,
+		Platform:         b.archAndCodeName.Name(),
+		IncludeBuild:     b.args.IncludeBuild,
+		IncludeTest:      b.args.IncludeTest,
+		IncludeOptional:  b.args.IncludeOptional,
+		SkipRecommended:  b.args.SkipRecommended,
 	})
 
+	b.printCacheStats()
+
+	if b.args.Offline {
+		err = b.checkOffline(name, list, err)
+	} else {
+		err = b.checkResolveError(err)
+	}
+
 	if err != nil {
+		b.summary.markRequested(name)
+		b.summary.add(&Result{Name: name, Status: StatusFailed, Err: err})
 		return err
 	}
 
+	b.summary.markRequested(list.Root().Formula().Name)
+
+	for _, f := range list.Installed() {
+		b.summary.add(&Result{Name: f.Name, Status: StatusSkipped, Reason: "already installed"})
+	}
+
 	fmt.Println("")
 
-	list.IterateChildFirst(b.threads, func(f *formula.Formula) {
+	// download all of the manifests and bottles first, so that brew only has to pour them.
+	// if some of the downloads fail, brew will download them by itself.
+	// in offline mode checkOffline already made sure they are all in the cache.
+	if !b.args.Offline {
+		if err := b.downloader.DownloadManifests(list.Formulae()); err != nil {
+			fmt.Printf("%s Some manifests couldn't be downloaded, brew will retry them\n", constant.RedArrow)
+		}
+
+		if err := b.downloader.DownloadBottles(list.Formulae()); err != nil {
+			fmt.Printf("%s Some bottles couldn't be downloaded, brew will retry them\n", constant.RedArrow)
+		}
+
+		fmt.Println("")
+	}
+
+	result := list.ScheduleChildFirst(b.threads, func(f *formula.Formula) error {
+
+		if f.IsInstalled() {
+			b.summary.add(&Result{Name: f.Name, Status: StatusSkipped, Reason: "already installed"})
+			return nil
+		}
 
 		fmt.Printf("%s Working On: %s\n", constant.GreenArrow, f.Name)
 
-		if err := b.brew.InstallFormula(f.Name, b.args.Verbose); err != nil {
+		// the cellar isn't reloaded until the next formula, it's the rack before the install.
+		rack := cellar.Get().Get(f.Name)
+
+		start := time.Now()
+		err := b.brew.InstallFormula(f.Name, b.args.Verbose)
+
+		if err != nil {
 			fmt.Printf("%s Error installing formula (%s): %s\n", constant.RedArrow, f.Name, err.Error())
 		}
+
+		// brew records every `brew install` as installed on request, not only the main formula.
+		if err == nil && b.isDependencyInstall(f.Name, list.Root().Formula().Name, rack) {
+			if err := b.brew.MarkAsDependency(f.Name); err != nil {
+				fmt.Printf("%s Couldn't mark %s as a dependency, uninstall -d will keep it: %s\n", constant.RedArrow, f.Name, err.Error())
+			}
+		}
+
+		b.addResult(f.Name, StatusInstalled, start, err)
+
+		return err
 	})
 
+	for _, skipped := range getNames(result.Skipped) {
+		b.summary.add(&Result{Name: skipped, Status: StatusSkipped, Reason: fmt.Sprintf("dependency %s failed", result.Skipped[skipped]), FailedDependency: result.Skipped[skipped]})
+	}
+
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("failed to install %d formulae: %s", len(result.Failed), strings.Join(getNames(result.Failed), ", "))
+	}
+
 	return nil
 }
 
-// UninstallFormula uninstalls the given formula.
-// Example: UninstallFormula("ffmpeg")
-func (b *BrewC) UninstallFormula(name string) error {
+// isDependencyInstall returns true if brew installed the formula only as a dependency of root:
+// it isn't root, it wasn't named on the command line, and it wasn't installed on request before.
+// rack is the installed formula before the install, nil if it wasn't installed.
+func (b *BrewC) isDependencyInstall(name string, root string, rack *cellar.Rack) bool {
+	if name == root || b.requested[cellar.GetShortName(name)] {
+		return false
+	}
 
-	if !b.args.DeleteUnusedDependencies && !b.args.DeleteAllNestedDependencies {
-		return b.brew.UninstallFormula(name, b.args.Verbose)
+	return rack == nil || !rack.InstalledOnRequest()
+}
+
+// FetchFormula downloads the manifests and bottles of the given formula and all of its dependencies,
+// resolved for the platform of the BrewC instance, into the download cache (see constant.SetCaches).
+// Nothing is installed, the installed formulae of this machine are fetched too.
+// Example: FetchFormula("ffmpeg")
+func (b *BrewC) FetchFormula(name string) error {
+	list, err := formula.GetFormulaList(name, &formula.GetFormulaListOpts{
+		IncludeInstalled: true,
+		DependencyLevel:  -1,
+		Threads:          b.threads,
+		Platform:         b.archAndCodeName.Name(),
+		IncludeBuild:     b.args.IncludeBuild,
+		IncludeTest:      b.args.IncludeTest,
+		IncludeOptional:  b.args.IncludeOptional,
+		SkipRecommended:  b.args.SkipRecommended,
+	})
+
+	b.printCacheStats()
+
+	if err = b.checkResolveError(err); err != nil {
+		b.summary.markRequested(name)
+		b.summary.add(&Result{Name: name, Status: StatusFailed, Err: err})
+		return err
 	}
 
-	dependencyLevel := 1
+	b.summary.markRequested(list.Root().Formula().Name)
 
-	if b.args.DeleteAllNestedDependencies {
-		dependencyLevel = -1
+	fmt.Println("")
+
+	results := b.downloader.Fetch(list.Formulae())
+	failed := make(map[string]error)
+
+	for _, f := range list.Formulae() {
+		r := results[f.Name]
+
+		switch {
+		case r.Err != nil:
+			failed[f.Name] = r.Err
+			b.summary.add(&Result{Name: f.Name, Status: StatusFailed, Duration: r.Duration, Err: r.Err})
+		case r.NoBottle:
+			b.summary.add(&Result{Name: f.Name, Status: StatusSkipped, Reason: "no bottle for " + b.archAndCodeName.Name()})
+		default:
+			b.summary.add(&Result{Name: f.Name, Status: StatusFetched, Duration: r.Duration})
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to fetch %d formulae: %s", len(failed), strings.Join(getNames(failed), ", "))
+	}
+
+	return nil
+}
+
+// GetDeps resolves the dependencies of the given formula for the platform of the BrewC instance,
+// the installed ones included, up to the given depth (0 means all of them).
+// Example: GetDeps("ffmpeg", 0)
+func (b *BrewC) GetDeps(name string, depth int) (*formula.FormulaList, error) {
+	if depth <= 0 {
+		depth = -1
 	}
 
 	list, err := formula.GetFormulaList(name, &formula.GetFormulaListOpts{
 		IncludeInstalled: true,
-		DependencyLevel:  dependencyLevel,
+		DependencyLevel:  depth,
 		Threads:          b.threads,
-		Unique:           true,
+		Platform:         b.archAndCodeName.Name(),
+		IncludeBuild:     b.args.IncludeBuild,
+		IncludeTest:      b.args.IncludeTest,
+		IncludeOptional:  b.args.IncludeOptional,
+		SkipRecommended:  b.args.SkipRecommended,
+		Quiet:            true,
 	})
 
-	if err != nil {
+	return list, b.checkResolveError(err)
+}
+
+// UninstallFormula uninstalls the given formula.
+// With --delete-unused-dependencies (or --delete-all-nested-dependencies for the nested ones),
+// its dependencies are uninstalled too, only the ones no other installed formula needs.
+// Example: UninstallFormula("ffmpeg")
+func (b *BrewC) UninstallFormula(name string) error {
+	b.summary.markRequested(name)
+
+	if !b.args.DeleteUnusedDependencies && !b.args.DeleteAllNestedDependencies {
+		start := time.Now()
+		err := b.brew.UninstallFormula(name, b.args.Verbose)
+		b.addResult(name, StatusUninstalled, start, err)
 		return err
 	}
 
-	fmt.Println("")
+	cellar.Reload()
 
-	list.IterateParentFirst(b.threads, func(f *formula.Formula) {
+	// only the dependencies nothing else needs are removed, see getOrphans
+	g := b.getInstalledGraph()
+	orphans, kept := g.getOrphans(cellar.GetShortName(name), b.args.DeleteAllNestedDependencies)
+
+	for _, dep := range getNames(kept) {
+		fmt.Printf("%s Keeping %s: %s\n", constant.BlueArrow, dep, kept[dep])
+		b.summary.add(&Result{Name: dep, Status: StatusSkipped, Reason: "kept, " + kept[dep]})
+	}
+
+	// the formula first, then every orphan once all of its dependents are uninstalled.
+	// the orphans of a formula that couldn't be uninstalled are kept.
+	result := g.getRemovalList(cellar.GetShortName(name), orphans, b.threads).ScheduleParentFirst(b.threads, func(f *formula.Formula) error {
 		fmt.Printf("%s Removing: %s\n", constant.GreenArrow, f.Name)
-		if err := b.brew.UninstallFormula(f.Name, b.args.Verbose); err != nil && b.args.Verbose {
-			fmt.Printf("%s Error uninstalling formula: %s\n", constant.RedArrow, err.Error())
+
+		start := time.Now()
+		err := b.brew.UninstallFormula(f.Name, b.args.Verbose)
+
+		if err != nil {
+			fmt.Printf("%s Error uninstalling formula (%s): %s\n", constant.RedArrow, f.Name, err.Error())
 		}
+
+		b.addResult(f.Name, StatusUninstalled, start, err)
+
+		return err
 	})
 
+	for _, dep := range getNames(result.Skipped) {
+		b.summary.add(&Result{Name: dep, Status: StatusSkipped, Reason: fmt.Sprintf("kept, %s wasn't uninstalled", result.Skipped[dep])})
+	}
+
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("failed to uninstall %d formulae: %s", len(result.Failed), strings.Join(getNames(result.Failed), ", "))
+	}
+
 	return nil
 }
 
 // ReinstallFormula uninstalls and then installs the given formula.
 // Example: ReinstallFormula("ffmpeg")
 func (b *BrewC) ReinstallFormula(name string) error {
-	return b.brew.ReinstallFormula(name, b.args.Verbose)
+	b.summary.markRequested(name)
+	start := time.Now()
+	err := b.brew.ReinstallFormula(name, b.args.Verbose)
+	b.addResult(name, StatusReinstalled, start, err)
+	return err
+}
+
+// addResult records the result of a brew command that started at the given time.
+func (b *BrewC) addResult(name string, status Status, start time.Time, err error) {
+	if err != nil {
+		status = StatusFailed
+	}
+
+	b.summary.add(&Result{Name: name, Status: status, Duration: time.Since(start), Err: err})
+}
+
+// checkResolveError returns the error of GetFormulaList,
+// unless it's only about some of the dependencies and --keep-going is set.
+func (b *BrewC) checkResolveError(err error) error {
+	var resolveErr *formula.ResolveError
+
+	if err == nil {
+		return nil
+	}
+
+	if !b.args.KeepGoing || !errors.As(err, &resolveErr) {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s\n", constant.RedArrow, err.Error())
+	fmt.Fprintf(os.Stderr, "%s Continuing with the resolved formulae (--keep-going)\n", constant.RedArrow)
+
+	return nil
+}
+
+// checkOffline returns an *OfflineError listing every formula, manifest and bottle
+// of the list missing from the local caches, err is the error of GetFormulaList.
+func (b *BrewC) checkOffline(name string, list *formula.FormulaList, err error) error {
+	var missing []string
+	var resolveErr *formula.ResolveError
+
+	switch {
+	case err == nil:
+	case errors.As(err, &resolveErr):
+		for _, e := range resolveErr.Errors {
+			if !errors.Is(e, formula.ErrNotCached) {
+				return err
+			}
+			missing = append(missing, "formula "+e.Error())
+		}
+	case errors.Is(err, formula.ErrNotCached):
+		return &OfflineError{Missing: []string{fmt.Sprintf("formula %s: %s", name, err.Error())}}
+	default:
+		return err
+	}
+
+	missing = append(missing, b.downloader.FindMissing(list.Formulae())...)
+
+	if len(missing) > 0 {
+		return &OfflineError{Missing: missing}
+	}
+
+	return nil
+}
+
+// printCacheStats prints the hits and misses of the formula cache in verbose mode.
+func (b *BrewC) printCacheStats() {
+	if !b.args.Verbose {
+		return
+	}
+
+	stats := formula.GetCacheStats()
+	fmt.Printf("%s Formula cache: %d hits, %d misses\n", constant.BlueArrow, stats.Hits, stats.Misses)
+}
+
+// getNames returns the sorted keys of the given map.
+func getNames[V any](m map[string]V) []string {
+	var names = make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
 }
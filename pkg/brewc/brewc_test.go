@@ -0,0 +1,44 @@
+package brewc
+
+import (
+	"testing"
+
+	"github.com/hamza72x/brewc/pkg/cellar"
+)
+
+// newRack returns an installed formula with a single keg.
+func newRack(name string, onRequest bool) *cellar.Rack {
+	return &cellar.Rack{
+		Name: name,
+		Kegs: []*cellar.Keg{{Version: "1.0", Receipt: &cellar.Receipt{InstalledOnRequest: onRequest}}},
+	}
+}
+
+func TestIsDependencyInstall(t *testing.T) {
+	b := &BrewC{requested: make(map[string]bool)}
+
+	// brewc install ffmpeg homebrew/core/x265
+	b.SetRequested([]string{"ffmpeg", "homebrew/core/x265"})
+
+	tests := []struct {
+		name string
+		rack *cellar.Rack
+		want bool
+	}{
+		{"ffmpeg", nil, false},
+		// requested too, ffmpeg depends on it
+		{"x265", nil, false},
+		{"lame", nil, true},
+		{"homebrew/core/lame", nil, true},
+		// upgraded by brew install, it was installed on request
+		{"sdl2", newRack("sdl2", true), false},
+		// upgraded by brew install, it was a dependency already
+		{"libvpx", newRack("libvpx", false), true},
+	}
+
+	for _, tt := range tests {
+		if got := b.isDependencyInstall(tt.name, "ffmpeg", tt.rack); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package brewc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OfflineError lists everything missing from the local caches in offline mode.
+type OfflineError struct {
+	Missing []string
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("offline mode, %d missing from the local caches:\n  %s", len(e.Missing), strings.Join(e.Missing, "\n  "))
+}
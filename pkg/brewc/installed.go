@@ -0,0 +1,292 @@
+package brewc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hamza72x/brewc/pkg/cellar"
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+)
+
+// installedGraph is the dependency graph of the installed formulae (racks of the Cellar).
+// The direct runtime dependencies of a formula are read from the install receipt of its latest keg,
+// or from its formula metadata when the receipt doesn't list them (no receipt, or an old one).
+type installedGraph struct {
+	cellar *cellar.Cellar
+
+	// key string: formula name
+	// value: names of its direct runtime dependencies, only the installed ones
+	dependencies map[string][]string
+
+	// key string: formula name
+	// value: names of the installed formulae depending on it directly
+	dependents map[string][]string
+}
+
+// getInstalledGraph builds the dependency graph of the installed formulae,
+// the formula metadata needed is fetched concurrently, b.threads at the same time.
+func (b *BrewC) getInstalledGraph() *installedGraph {
+	g := &installedGraph{
+		cellar:       cellar.Get(),
+		dependencies: make(map[string][]string),
+		dependents:   make(map[string][]string),
+	}
+
+	var wg sync.WaitGroup
+	var conn = make(chan int, b.threads)
+	var lock sync.Mutex
+
+	for _, rack := range g.cellar.Racks() {
+		if deps, ok := getReceiptDependencies(rack); ok {
+			lock.Lock()
+			g.dependencies[rack.Name] = deps
+			lock.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(rack *cellar.Rack) {
+			conn <- 1
+
+			defer wg.Done()
+			defer func() { <-conn }()
+
+			f, err := formula.GetFormulaJSON(rack.Name)
+
+			// example: a formula of a removed tap, it's treated as having no dependencies.
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s Dependencies of %s unknown: %s\n", constant.RedArrow, rack.Name, err.Error())
+				return
+			}
+
+			deps := f.GetDependencies(b.archAndCodeName.Name())
+
+			lock.Lock()
+			g.dependencies[rack.Name] = deps
+			lock.Unlock()
+		}(rack)
+	}
+
+	wg.Wait()
+
+	for name, deps := range g.dependencies {
+		var installed []string
+
+		for _, dep := range deps {
+			dep = cellar.GetShortName(dep)
+
+			if g.cellar.Get(dep) != nil {
+				installed = append(installed, dep)
+				g.dependents[dep] = append(g.dependents[dep], name)
+			}
+		}
+
+		g.dependencies[name] = installed
+	}
+
+	for _, dependents := range g.dependents {
+		sort.Strings(dependents)
+	}
+
+	return g
+}
+
+// getReceiptDependencies returns the direct runtime dependencies listed in the receipt of the latest keg.
+// The second value is false if the receipt doesn't tell them apart from the indirect ones.
+func getReceiptDependencies(rack *cellar.Rack) ([]string, bool) {
+	receipt := rack.Latest().Receipt
+
+	if receipt == nil || receipt.RuntimeDependencies == nil {
+		return nil, false
+	}
+
+	var deps = []string{}
+
+	for _, dep := range receipt.RuntimeDependencies {
+		if dep.DeclaredDirectly {
+			deps = append(deps, dep.FullName)
+		}
+	}
+
+	// the receipts written before declared_directly existed
+	if len(deps) == 0 && len(receipt.RuntimeDependencies) > 0 {
+		return nil, false
+	}
+
+	return deps, true
+}
+
+// getDependents returns the installed formulae depending on the given one,
+// directly or, if recursive is set, through other installed formulae too.
+// The value is the formula it depends on along the way, the given one for the direct dependents.
+// example: uses of x265: ffmpeg => x265, and recursively mpv => ffmpeg
+func (g *installedGraph) getDependents(name string, recursive bool) map[string]string {
+	var found = make(map[string]string)
+	var queue = []string{name}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, dependent := range g.dependents[current] {
+			if _, ok := found[dependent]; ok || dependent == name {
+				continue
+			}
+
+			found[dependent] = current
+
+			if recursive {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	return found
+}
+
+// getOrphans returns the dependencies of the given formula nothing else needs once it's uninstalled,
+// the direct ones, or all of them if recursive is set. They are sorted in removal order, the dependents first.
+// The formulae installed on request are never orphans.
+// The second value is the reason every other dependency is kept, example: still needed by mpv
+func (g *installedGraph) getOrphans(name string, recursive bool) ([]string, map[string]string) {
+	var removed = map[string]bool{name: true}
+	var candidates = make(map[string]bool)
+
+	for _, dep := range g.dependencies[name] {
+		candidates[dep] = true
+	}
+
+	// a dependency can only be removed once all of its dependents are, so it's repeated until nothing changes.
+	for changed := true; changed; {
+		changed = false
+
+		for _, c := range getNames(candidates) {
+			if removed[c] || !g.isOrphan(c, removed) {
+				continue
+			}
+
+			removed[c] = true
+			changed = true
+
+			if recursive {
+				for _, dep := range g.dependencies[c] {
+					candidates[dep] = true
+				}
+			}
+		}
+	}
+
+	var kept = make(map[string]string)
+
+	for c := range candidates {
+		if removed[c] {
+			continue
+		}
+
+		if g.cellar.Get(c).InstalledOnRequest() {
+			kept[c] = "installed on request"
+			continue
+		}
+
+		var neededBy []string
+
+		for _, dependent := range g.dependents[c] {
+			if !removed[dependent] {
+				neededBy = append(neededBy, dependent)
+			}
+		}
+
+		kept[c] = "still needed by " + strings.Join(neededBy, ", ")
+	}
+
+	delete(removed, name)
+
+	return g.sortForRemoval(removed), kept
+}
+
+// isOrphan returns true if the formula was installed as a dependency and all of its dependents are removed.
+func (g *installedGraph) isOrphan(name string, removed map[string]bool) bool {
+	if g.cellar.Get(name).InstalledOnRequest() {
+		return false
+	}
+
+	for _, dependent := range g.dependents[name] {
+		if !removed[dependent] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getRemovalList returns the list of the given formula and its orphans (see getOrphans),
+// with the dependencies between them, to uninstall them parent first.
+func (g *installedGraph) getRemovalList(name string, orphans []string, threads int) *formula.FormulaList {
+	var formulae = map[string]*formula.Formula{name: {Name: name}}
+
+	for _, orphan := range orphans {
+		formulae[orphan] = &formula.Formula{Name: orphan}
+	}
+
+	list := formula.NewFormulaList(formulae[name], threads)
+
+	for parent, f := range formulae {
+		for _, dep := range g.dependencies[parent] {
+			if child, ok := formulae[dep]; ok {
+				list.AddDependency(f, child)
+			}
+		}
+	}
+
+	return list
+}
+
+// sortForRemoval returns the given formulae sorted so that every formula comes before its dependencies,
+// the ones without an order between them are sorted by name.
+func (g *installedGraph) sortForRemoval(formulae map[string]bool) []string {
+	var pending = make(map[string]int, len(formulae))
+
+	for name := range formulae {
+		for _, dependent := range g.dependents[name] {
+			if formulae[dependent] {
+				pending[name]++
+			}
+		}
+	}
+
+	var sorted []string
+	var ready []string
+
+	for name := range formulae {
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	for len(ready) > 0 {
+		sort.Strings(ready)
+
+		name := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, name)
+
+		for _, dep := range g.dependencies[name] {
+			if !formulae[dep] {
+				continue
+			}
+
+			pending[dep]--
+
+			if pending[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	return sorted
+}
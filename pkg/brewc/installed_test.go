@@ -0,0 +1,213 @@
+package brewc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hamza72x/brewc/pkg/cellar"
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+)
+
+// useTestCellar points the Cellar to a temporary directory, see writeKeg.
+func useTestCellar(t *testing.T) *BrewC {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	t.Setenv("HOMEBREW_PREFIX", filepath.Join(dir, "prefix"))
+	t.Setenv("HOMEBREW_CELLAR", filepath.Join(dir, "prefix", "Cellar"))
+	t.Setenv("HOMEBREW_CACHE", filepath.Join(dir, "cache"))
+
+	if err := constant.Initialize(models.Arm64, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	cellar.Reload()
+	t.Cleanup(cellar.Reload)
+
+	return &BrewC{threads: 2, archAndCodeName: &models.ArchAndCodeName{Architecture: models.Arm64, CodeName: models.Sonoma}}
+}
+
+// writeKeg installs a keg of the formula into the Cellar of useTestCellar, with its direct dependencies in the receipt.
+func writeKeg(t *testing.T, name string, onRequest bool, deps ...string) {
+	t.Helper()
+
+	receipt := cellar.Receipt{InstalledOnRequest: onRequest, InstalledAsDependency: !onRequest, RuntimeDependencies: []cellar.RuntimeDependency{}}
+
+	for _, dep := range deps {
+		receipt.RuntimeDependencies = append(receipt.RuntimeDependencies, cellar.RuntimeDependency{FullName: dep, DeclaredDirectly: true})
+	}
+
+	writeReceipt(t, name, receipt)
+}
+
+// writeReceipt writes the receipt of a keg of the formula into the Cellar of useTestCellar.
+func writeReceipt(t *testing.T, name string, receipt cellar.Receipt) {
+	t.Helper()
+
+	dir := filepath.Join(constant.Get().DirCellar, name, "1.0")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(receipt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "INSTALL_RECEIPT.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetOrphans(t *testing.T) {
+	b := useTestCellar(t)
+
+	writeKeg(t, "ffmpeg", true, "x265", "lame", "sdl2", "libass")
+	writeKeg(t, "x265", false)
+	// shared with sox
+	writeKeg(t, "lame", false)
+	writeKeg(t, "sox", true, "lame")
+	// installed on request too
+	writeKeg(t, "sdl2", true)
+	// nested, only removed with -D
+	writeKeg(t, "libass", false, "freetype", "libpng")
+	writeKeg(t, "freetype", false, "libpng")
+	writeKeg(t, "libpng", false)
+
+	g := b.getInstalledGraph()
+
+	wantKept := map[string]string{
+		"lame": "still needed by sox",
+		"sdl2": "installed on request",
+	}
+
+	orphans, kept := g.getOrphans("ffmpeg", false)
+
+	if want := []string{"libass", "x265"}; !reflect.DeepEqual(orphans, want) {
+		t.Fatalf("-d: orphans %v, want %v", orphans, want)
+	}
+
+	if !reflect.DeepEqual(kept, wantKept) {
+		t.Fatalf("-d: kept %v, want %v", kept, wantKept)
+	}
+
+	orphans, kept = g.getOrphans("ffmpeg", true)
+
+	// every formula comes before its dependencies: libass, freetype, then libpng
+	if want := []string{"libass", "freetype", "libpng", "x265"}; !reflect.DeepEqual(orphans, want) {
+		t.Fatalf("-D: orphans %v, want %v", orphans, want)
+	}
+
+	if !reflect.DeepEqual(kept, wantKept) {
+		t.Fatalf("-D: kept %v, want %v", kept, wantKept)
+	}
+
+	// uninstalled with a single worker, the formula first, then the orphans once their dependents are.
+	var removed []string
+
+	g.getRemovalList("ffmpeg", orphans, 1).IterateParentFirst(1, func(f *formula.Formula) {
+		removed = append(removed, f.Name)
+	})
+
+	var position = make(map[string]int)
+
+	for i, name := range removed {
+		position[name] = i
+	}
+
+	if len(removed) != 5 || position["ffmpeg"] != 0 || position["libass"] > position["freetype"] || position["freetype"] > position["libpng"] {
+		t.Fatalf("removed in the order %v", removed)
+	}
+}
+
+func TestGetReceiptDependencies(t *testing.T) {
+	declared := []cellar.RuntimeDependency{
+		{FullName: "ffmpeg", DeclaredDirectly: true},
+		{FullName: "x265", DeclaredDirectly: false},
+	}
+
+	// written before declared_directly existed
+	old := []cellar.RuntimeDependency{{FullName: "ffmpeg"}, {FullName: "x265"}}
+
+	tests := []struct {
+		name    string
+		receipt *cellar.Receipt
+		want    []string
+		ok      bool
+	}{
+		{"no receipt", nil, nil, false},
+		{"no runtime dependencies", &cellar.Receipt{}, nil, false},
+		{"declared directly", &cellar.Receipt{RuntimeDependencies: declared}, []string{"ffmpeg"}, true},
+		{"old receipt", &cellar.Receipt{RuntimeDependencies: old}, nil, false},
+		{"no dependencies", &cellar.Receipt{RuntimeDependencies: []cellar.RuntimeDependency{}}, []string{}, true},
+	}
+
+	for _, tt := range tests {
+		rack := &cellar.Rack{Name: "mpv", Kegs: []*cellar.Keg{{Version: "1.0", Receipt: tt.receipt}}}
+
+		got, ok := getReceiptDependencies(rack)
+
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetDependents(t *testing.T) {
+	b := useTestCellar(t)
+
+	formula.SetOffline(true)
+	t.Cleanup(func() { formula.SetOffline(false) })
+
+	// the receipt of mpv doesn't tell its direct dependencies apart, they come from the formula metadata.
+	writeReceipt(t, "mpv", cellar.Receipt{InstalledOnRequest: true, RuntimeDependencies: []cellar.RuntimeDependency{{FullName: "ffmpeg"}, {FullName: "x265"}}})
+	writeFormulaJSON(t, `{"name": "mpv", "versions": {"stable": "1.0"}, "dependencies": ["ffmpeg", "libass"]}`)
+
+	writeKeg(t, "ffmpeg", false, "x265")
+	writeKeg(t, "x265", false)
+	writeKeg(t, "handbrake", true, "homebrew/core/x265")
+
+	g := b.getInstalledGraph()
+
+	// libass isn't installed, x265 is only an indirect dependency
+	if deps := g.dependencies["mpv"]; !reflect.DeepEqual(deps, []string{"ffmpeg"}) {
+		t.Fatalf("dependencies of mpv %v", deps)
+	}
+
+	if got, want := g.getDependents("x265", false), map[string]string{"ffmpeg": "x265", "handbrake": "x265"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("direct: got %v, want %v", got, want)
+	}
+
+	if got, want := g.getDependents("x265", true), map[string]string{"ffmpeg": "x265", "handbrake": "x265", "mpv": "ffmpeg"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("recursive: got %v, want %v", got, want)
+	}
+}
+
+// writeFormulaJSON writes the json of a formula into the formula cache of the offline mode.
+func writeFormulaJSON(t *testing.T, data string) {
+	t.Helper()
+
+	var f formula.Formula
+
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	path := formula.GetFormulaCachePath(f.Name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package brewc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+	"github.com/hamza72x/brewc/pkg/util"
+)
+
+const (
+	offlineTag = "arm64_sonoma"
+
+	// sha256 of "bottle"
+	bottleSha256 = "7def9c79e5be6d7a70022168b8b099ce1e707a2fd809a60fab73de6de578884b"
+)
+
+// writeFormula writes the json of a formula with a bottle for offlineTag (unless bottle is false)
+// into the formula cache of the offline mode.
+func writeFormula(t *testing.T, name string, bottle bool, deps ...string) {
+	t.Helper()
+
+	files := "{}"
+
+	if bottle {
+		files = fmt.Sprintf(`{"%s": {"url": "https://ghcr.io/v2/homebrew/core/%s/blobs/sha256:%s", "sha256": "%s"}}`, offlineTag, name, bottleSha256, bottleSha256)
+	}
+
+	depsJSON := "[]"
+
+	if len(deps) > 0 {
+		depsJSON = fmt.Sprintf(`["%s"]`, joinQuoted(deps))
+	}
+
+	data := fmt.Sprintf(`{"name": "%s", "full_name": "%s", "versions": {"stable": "1.0"}, "dependencies": %s, "bottle": {"stable": {"files": %s}}}`, name, name, depsJSON, files)
+
+	path := formula.GetFormulaCachePath(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func joinQuoted(names []string) string {
+	s := names[0]
+
+	for _, name := range names[1:] {
+		s += `", "` + name
+	}
+
+	return s
+}
+
+// writeCache writes the manifest and (if content isn't empty) the bottle of the formula into brew's download cache.
+func writeCache(t *testing.T, name string, manifest bool, content string) {
+	t.Helper()
+
+	f, err := formula.GetFormulaJSON(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest {
+		if err := os.WriteFile(f.GetManifestDownloadPath(), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(content) > 0 {
+		if err := os.WriteFile(f.GetBottleDownloadPath(offlineTag), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckOffline(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("HOMEBREW_PREFIX", filepath.Join(dir, "prefix"))
+	t.Setenv("HOMEBREW_CELLAR", filepath.Join(dir, "prefix", "Cellar"))
+	t.Setenv("HOMEBREW_CACHE", filepath.Join(dir, "cache"))
+
+	if err := constant.Initialize(models.Arm64, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if util.Sha256("bottle") != bottleSha256 {
+		t.Fatalf("bottleSha256 is %s", util.Sha256("bottle"))
+	}
+
+	platform, _ := models.ParsePlatform(offlineTag)
+	b := NewFetcher(&models.OptionalArgs{Offline: true, Threads: 2}, platform)
+
+	// top has no bottle, brew builds it from the source
+	writeFormula(t, "top", false, "cached", "corrupted", "uncached", "unknown")
+	writeFormula(t, "cached", true)
+	writeFormula(t, "corrupted", true)
+	writeFormula(t, "uncached", true)
+
+	writeCache(t, "cached", true, "bottle")
+	writeCache(t, "corrupted", true, "truncated")
+
+	list, err := formula.GetFormulaList("top", &formula.GetFormulaListOpts{
+		IncludeInstalled: true,
+		DependencyLevel:  -1,
+		Threads:          2,
+		Platform:         offlineTag,
+		Quiet:            true,
+	})
+
+	err = b.checkOffline("top", list, err)
+
+	var offlineErr *OfflineError
+
+	if !errors.As(err, &offlineErr) {
+		t.Fatalf("expected an *OfflineError, got %v", err)
+	}
+
+	corrupted, _ := formula.GetFormulaJSON("corrupted")
+	uncached, _ := formula.GetFormulaJSON("uncached")
+
+	want := []string{
+		fmt.Sprintf("formula unknown: not in the local formula cache: %s", formula.GetFormulaCachePath("unknown")),
+		fmt.Sprintf("bottle of corrupted (%s, invalid sha256)", corrupted.GetBottleDownloadPath(offlineTag)),
+		fmt.Sprintf("manifest of uncached (%s)", uncached.GetManifestDownloadPath()),
+		fmt.Sprintf("bottle of uncached (%s)", uncached.GetBottleDownloadPath(offlineTag)),
+	}
+
+	if !reflect.DeepEqual(offlineErr.Missing, want) {
+		t.Fatalf("missing:\n%q\nwant:\n%q", offlineErr.Missing, want)
+	}
+
+	// the main formula itself isn't cached
+	err = b.checkOffline("nothing", nil, formula.ErrNotCached)
+
+	if !errors.As(err, &offlineErr) || len(offlineErr.Missing) != 1 {
+		t.Fatalf("expected an *OfflineError with the main formula, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package brewc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a formula in a command.
+type Status string
+
+const (
+	StatusInstalled   Status = "installed"
+	StatusUninstalled Status = "uninstalled"
+	StatusReinstalled Status = "reinstalled"
+	StatusFetched     Status = "fetched"
+	StatusSkipped     Status = "skipped"
+	StatusFailed      Status = "failed"
+)
+
+// Result is the outcome of a single formula.
+type Result struct {
+	Name     string
+	Status   Status
+	Duration time.Duration
+
+	// Reason explains a skipped formula, example: already installed
+	Reason string
+
+	// Err is set for the failed formulae
+	Err error
+
+	// FailedDependency is set for the formulae skipped because this dependency failed
+	FailedDependency string
+}
+
+// Summary collects the results of every formula handled by a BrewC instance.
+type Summary struct {
+	results []*Result
+
+	// key string: formula name
+	// the formulae requested on the command line, see markRequested
+	requested map[string]bool
+
+	// lock is used to make the summary thread-safe
+	lock *sync.Mutex
+}
+
+func newSummary() *Summary {
+	return &Summary{
+		requested: make(map[string]bool),
+		lock:      &sync.Mutex{},
+	}
+}
+
+// add records the result of a formula.
+// a formula is only listed once, a failure replaces its previous result.
+func (s *Summary) add(result *Result) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, r := range s.results {
+		if r.Name == result.Name {
+			if result.Status == StatusFailed {
+				s.results[i] = result
+			}
+			return
+		}
+	}
+
+	s.results = append(s.results, result)
+}
+
+// markRequested records that the formula of the given name was requested on the command line,
+// not only handled as a dependency.
+func (s *Summary) markRequested(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requested[name] = true
+}
+
+// Outcome counts the formulae brew ran for: the succeeded ones (installed, uninstalled, reinstalled or fetched)
+// and the failed ones, including the ones skipped because a dependency failed.
+// requested is the number of the requested formulae that succeeded.
+func (s *Summary) Outcome() (succeeded int, failed int, requested int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, r := range s.results {
+		switch {
+		case r.Status == StatusFailed || len(r.FailedDependency) > 0:
+			failed++
+		case r.Status != StatusSkipped:
+			succeeded++
+
+			if s.requested[r.Name] {
+				requested++
+			}
+		}
+	}
+
+	return succeeded, failed, requested
+}
+
+// Results returns the results in the order they were recorded.
+func (s *Summary) Results() []*Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*Result{}, s.results...)
+}
+
+// Print writes the summary as a table to the given writer.
+func (s *Summary) Print(out io.Writer) {
+	results := s.Results()
+
+	if len(results) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FORMULA\tSTATUS\tDURATION\tDETAILS")
+
+	for _, r := range results {
+		details := r.Reason
+
+		// only the first line of a multi-line error fits in the table.
+		if r.Err != nil {
+			details = strings.SplitN(r.Err.Error(), "\n", 2)[0]
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Status, r.Duration.Round(time.Millisecond), details)
+	}
+
+	w.Flush()
+}
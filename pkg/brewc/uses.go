@@ -0,0 +1,89 @@
+package brewc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hamza72x/brewc/pkg/cellar"
+)
+
+// Use is an installed formula depending on another one, see GetUses.
+type Use struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// Direct is true if it depends on the formula directly.
+	Direct bool `json:"direct"`
+
+	// Via is the formula it depends on along the way, for the indirect dependents.
+	Via string `json:"via,omitempty"`
+
+	// InstalledOnRequest is false for the formulae installed only as a dependency.
+	InstalledOnRequest bool `json:"installed_on_request"`
+}
+
+// GetUses returns the installed formulae depending on the given one, sorted by name,
+// only the direct dependents unless recursive is set.
+// Example: GetUses("x265", true)
+func (b *BrewC) GetUses(name string, recursive bool) []*Use {
+	name = cellar.GetShortName(name)
+
+	g := b.getInstalledGraph()
+
+	var uses []*Use
+
+	for dependent, via := range g.getDependents(name, recursive) {
+		rack := g.cellar.Get(dependent)
+
+		use := &Use{
+			Name:               dependent,
+			Version:            rack.Latest().Version,
+			Direct:             via == name,
+			InstalledOnRequest: rack.InstalledOnRequest(),
+		}
+
+		if !use.Direct {
+			use.Via = via
+		}
+
+		uses = append(uses, use)
+	}
+
+	sort.Slice(uses, func(i, j int) bool {
+		return uses[i].Name < uses[j].Name
+	})
+
+	return uses
+}
+
+// WriteUses writes the uses as a list, one formula per line.
+// example: mpv 0.36.0_1 (via ffmpeg)
+func WriteUses(w io.Writer, uses []*Use) error {
+	for _, use := range uses {
+		line := use.Name + " " + use.Version
+
+		if !use.Direct {
+			line += fmt.Sprintf(" (via %s)", use.Via)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteUsesJSON writes the uses as a json array.
+func WriteUsesJSON(w io.Writer, uses []*Use) error {
+	if uses == nil {
+		uses = []*Use{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(uses)
+}
@@ -0,0 +1,319 @@
+package cellar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/util"
+)
+
+// State is the install state of a formula.
+type State int
+
+const (
+	// NotInstalled means there is no keg of the formula in the Cellar.
+	NotInstalled State = iota
+
+	// Outdated means the formula is installed, but not in its current version.
+	Outdated
+
+	// Current means the current version of the formula is installed.
+	Current
+)
+
+func (s State) String() string {
+	switch s {
+	case Outdated:
+		return "outdated"
+	case Current:
+		return "current"
+	default:
+		return "not installed"
+	}
+}
+
+// Cellar is the install state of every formula, read from brew's Cellar.
+// example: /opt/homebrew/Cellar/{name}/{version}/INSTALL_RECEIPT.json
+type Cellar struct {
+	dir string
+
+	// key string: formula name
+	racks map[string]*Rack
+}
+
+// Rack is an installed formula, with all of its installed versions (kegs).
+// example: /opt/homebrew/Cellar/openssl@3
+type Rack struct {
+	Name string
+
+	// Kegs are sorted by the install time of their receipts, the latest last.
+	Kegs []*Keg
+
+	// Pinned is true if the formula is pinned with `brew pin`.
+	Pinned bool
+}
+
+// Keg is an installed version of a formula.
+// example: /opt/homebrew/Cellar/openssl@3/3.1.0
+type Keg struct {
+	// Version is the folder name, it includes the revision, example: 3.1.0_1
+	Version string
+	Path    string
+
+	// Receipt is nil if the keg has no (or an invalid) INSTALL_RECEIPT.json
+	Receipt *Receipt
+}
+
+// Receipt is the INSTALL_RECEIPT.json brew writes into every keg.
+type Receipt struct {
+	HomebrewVersion       string              `json:"homebrew_version"`
+	InstalledAsDependency bool                `json:"installed_as_dependency"`
+	InstalledOnRequest    bool                `json:"installed_on_request"`
+	PouredFromBottle      bool                `json:"poured_from_bottle"`
+	LoadedFromAPI         bool                `json:"loaded_from_api"`
+	Time                  int64               `json:"time"`
+	RuntimeDependencies   []RuntimeDependency `json:"runtime_dependencies"`
+	Source                ReceiptSource       `json:"source"`
+}
+
+type RuntimeDependency struct {
+	FullName         string `json:"full_name"`
+	Version          string `json:"version"`
+	Revision         int64  `json:"revision"`
+	PkgVersion       string `json:"pkg_version"`
+	DeclaredDirectly bool   `json:"declared_directly"`
+}
+
+type ReceiptSource struct {
+	Path     string `json:"path"`
+	Tap      string `json:"tap"`
+	Spec     string `json:"spec"`
+	Versions struct {
+		Stable        string `json:"stable"`
+		Head          string `json:"head"`
+		VersionScheme int64  `json:"version_scheme"`
+	} `json:"versions"`
+}
+
+var (
+	instance *Cellar
+	lock     sync.Mutex
+)
+
+// Get returns the install state of the Cellar of constant.Get().DirCellar,
+// it's scanned once and reused until Reload is called.
+func Get() *Cellar {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if instance == nil {
+		instance = Scan(constant.Get().DirCellar, constant.Get().DirPrefix)
+	}
+
+	return instance
+}
+
+// Reload scans the Cellar again on the next call of Get,
+// example: after brew installed or uninstalled something.
+func Reload() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	instance = nil
+}
+
+// Scan reads every keg of the given Cellar directory,
+// prefix is HOMEBREW_PREFIX, where brew keeps the pinned formulae.
+// A missing Cellar is an empty one.
+func Scan(dir string, prefix string) *Cellar {
+	c := &Cellar{
+		dir:   dir,
+		racks: make(map[string]*Rack),
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return c
+	}
+
+	pinnedDir := filepath.Join(prefix, "var", "homebrew", "pinned")
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		rack := scanRack(filepath.Join(dir, entry.Name()))
+
+		if len(rack.Kegs) == 0 {
+			continue
+		}
+
+		_, err := os.Lstat(filepath.Join(pinnedDir, rack.Name))
+		rack.Pinned = err == nil
+
+		c.racks[rack.Name] = rack
+	}
+
+	return c
+}
+
+// scanRack reads the kegs of a formula folder in the Cellar.
+func scanRack(path string) *Rack {
+	rack := &Rack{Name: filepath.Base(path)}
+
+	entries, err := os.ReadDir(path)
+
+	if err != nil {
+		return rack
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		keg := &Keg{
+			Version: entry.Name(),
+			Path:    filepath.Join(path, entry.Name()),
+		}
+
+		receiptPath := filepath.Join(keg.Path, "INSTALL_RECEIPT.json")
+
+		if util.DoesFileExist(receiptPath) {
+			keg.Receipt = readReceipt(receiptPath)
+		}
+
+		rack.Kegs = append(rack.Kegs, keg)
+	}
+
+	sort.SliceStable(rack.Kegs, func(i, j int) bool {
+		return rack.Kegs[i].getTime() < rack.Kegs[j].getTime()
+	})
+
+	return rack
+}
+
+// readReceipt decodes the INSTALL_RECEIPT.json at the given path, nil if it's invalid.
+func readReceipt(path string) *Receipt {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil
+	}
+
+	defer file.Close()
+
+	var r Receipt
+
+	if err := json.NewDecoder(file).Decode(&r); err != nil {
+		return nil
+	}
+
+	return &r
+}
+
+// Get returns the installed formula of the given name, nil if it's not installed.
+func (c *Cellar) Get(name string) *Rack {
+	return c.racks[GetShortName(name)]
+}
+
+// Racks returns every installed formula, sorted by name.
+func (c *Cellar) Racks() []*Rack {
+	var racks = make([]*Rack, 0, len(c.racks))
+
+	for _, rack := range c.racks {
+		racks = append(racks, rack)
+	}
+
+	sort.Slice(racks, func(i, j int) bool {
+		return racks[i].Name < racks[j].Name
+	})
+
+	return racks
+}
+
+// GetState returns the install state of the formula of the given name,
+// pkgVersion is its current version including the revision, example: 3.1.0_1
+func (c *Cellar) GetState(name string, pkgVersion string) State {
+	rack := c.Get(name)
+
+	if rack == nil {
+		return NotInstalled
+	}
+
+	if rack.GetKeg(pkgVersion) != nil {
+		return Current
+	}
+
+	return Outdated
+}
+
+// GetKeg returns the keg of the given version, nil if that version isn't installed.
+func (r *Rack) GetKeg(version string) *Keg {
+	for _, keg := range r.Kegs {
+		if keg.Version == version {
+			return keg
+		}
+	}
+	return nil
+}
+
+// Versions returns the installed versions.
+func (r *Rack) Versions() []string {
+	var versions = make([]string, len(r.Kegs))
+
+	for i, keg := range r.Kegs {
+		versions[i] = keg.Version
+	}
+
+	return versions
+}
+
+// Latest returns the most recently installed keg.
+func (r *Rack) Latest() *Keg {
+	return r.Kegs[len(r.Kegs)-1]
+}
+
+// InstalledOnRequest returns true if the latest keg was installed explicitly, not only as a dependency.
+// a keg without a receipt counts as installed on request, so that it's never treated as removable.
+func (r *Rack) InstalledOnRequest() bool {
+	receipt := r.Latest().Receipt
+	return receipt == nil || receipt.InstalledOnRequest
+}
+
+// RuntimeDependencies returns the full names of the runtime dependencies of the latest keg.
+func (r *Rack) RuntimeDependencies() []string {
+	receipt := r.Latest().Receipt
+
+	if receipt == nil {
+		return nil
+	}
+
+	var deps = make([]string, len(receipt.RuntimeDependencies))
+
+	for i, dep := range receipt.RuntimeDependencies {
+		deps[i] = dep.FullName
+	}
+
+	return deps
+}
+
+func (k *Keg) getTime() int64 {
+	if k.Receipt == nil {
+		return 0
+	}
+	return k.Receipt.Time
+}
+
+// GetShortName returns the name of a formula without its tap, the name of its rack.
+// example: homebrew/core/openssl@3 => openssl@3
+func GetShortName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
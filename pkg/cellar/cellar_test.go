@@ -0,0 +1,130 @@
+package cellar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeKeg creates a keg in the Cellar, with the given receipt if it isn't empty.
+func writeKeg(t *testing.T, dir string, name string, version string, receipt string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name, version)
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(receipt) == 0 {
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(path, "INSTALL_RECEIPT.json"), []byte(receipt), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	prefix := t.TempDir()
+	dir := filepath.Join(prefix, "Cellar")
+
+	// the folder names are not in the install order
+	writeKeg(t, dir, "openssl@3", "3.1.0", `{"installed_on_request": false, "installed_as_dependency": true, "time": 300,
+		"runtime_dependencies": [{"full_name": "ca-certificates", "pkg_version": "2023-01-10", "declared_directly": true}]}`)
+	writeKeg(t, dir, "openssl@3", "3.0.8_1", `{"installed_on_request": true, "time": 100}`)
+	writeKeg(t, dir, "ca-certificates", "2023-01-10", `{"installed_on_request": false, "time": 200}`)
+	// no receipt, and an invalid one
+	writeKeg(t, dir, "git", "2.40.0", "")
+	writeKeg(t, dir, "wget", "1.21.3", "{")
+	// not installed formulae
+	writeKeg(t, dir, ".hidden", "1.0", `{}`)
+
+	if err := os.MkdirAll(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := filepath.Join(prefix, "var", "homebrew", "pinned")
+
+	if err := os.MkdirAll(pinned, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "git", "2.40.0"), filepath.Join(pinned, "git")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Scan(dir, prefix)
+
+	var names []string
+
+	for _, rack := range c.Racks() {
+		names = append(names, rack.Name)
+	}
+
+	if want := []string{"ca-certificates", "git", "openssl@3", "wget"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("racks %v, want %v", names, want)
+	}
+
+	openssl := c.Get("homebrew/core/openssl@3")
+
+	if want := []string{"3.0.8_1", "3.1.0"}; !reflect.DeepEqual(openssl.Versions(), want) {
+		t.Fatalf("kegs of openssl@3 %v, want %v", openssl.Versions(), want)
+	}
+
+	if openssl.InstalledOnRequest() {
+		t.Fatal("the latest keg of openssl@3 was installed as a dependency")
+	}
+
+	if deps := openssl.RuntimeDependencies(); !reflect.DeepEqual(deps, []string{"ca-certificates"}) {
+		t.Fatalf("dependencies of openssl@3 %v", deps)
+	}
+
+	if openssl.Pinned || !c.Get("git").Pinned {
+		t.Fatal("only git is pinned")
+	}
+
+	// a keg without a valid receipt is never removable
+	for _, name := range []string{"git", "wget"} {
+		rack := c.Get(name)
+
+		if rack.Latest().Receipt != nil || !rack.InstalledOnRequest() || rack.RuntimeDependencies() != nil {
+			t.Fatalf("%s: %+v", name, rack.Latest())
+		}
+	}
+}
+
+func TestGetState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Cellar")
+
+	writeKeg(t, dir, "libvmaf", "2.3.1", `{"time": 1}`)
+	writeKeg(t, dir, "libvmaf", "2.3.1_1", `{"time": 2}`)
+	writeKeg(t, dir, "x265", "3.5", `{"time": 1}`)
+
+	c := Scan(dir, filepath.Dir(dir))
+
+	tests := []struct {
+		name       string
+		pkgVersion string
+		want       State
+	}{
+		{"libvmaf", "2.3.1_1", Current},
+		// an older keg is still installed
+		{"libvmaf", "2.3.1", Current},
+		{"homebrew/core/x265", "3.5", Current},
+		{"x265", "3.5_1", Outdated},
+		{"ffmpeg", "6.0", NotInstalled},
+	}
+
+	for _, tt := range tests {
+		if got := c.GetState(tt.name, tt.pkgVersion); got != tt.want {
+			t.Errorf("%s %s: got %s, want %s", tt.name, tt.pkgVersion, got, tt.want)
+		}
+	}
+
+	// a missing Cellar is an empty one
+	if racks := Scan(filepath.Join(dir, "missing"), dir).Racks(); len(racks) != 0 {
+		t.Fatalf("racks of a missing Cellar: %v", racks)
+	}
+}
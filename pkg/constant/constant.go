@@ -3,7 +3,9 @@ package constant
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/hamza72x/brewc/pkg/util"
 	col "github.com/hamza72x/go-color"
@@ -14,32 +16,63 @@ var BlueArrow = col.Info("<==>")
 var RedArrow = col.Red("<==>")
 
 type Constant struct {
+	DirPrefix    string
 	DirCellar    string
 	DirCaches    string
 	DirDownloads string
+
+	// DirBrewc is where brewc keeps its own caches, the formula json and the formula index.
+	// example: $HOMEBREW_CACHE/brewc, it stays in brew's cache when SetCaches moves the downloads.
+	DirBrewc string
 }
 
 var instance *Constant
 
-func Initialize(arch string) {
-	dirHome, err := os.UserHomeDir()
+// Initialize sets the brew directories, from the environment variables brew honors
+// (HOMEBREW_PREFIX, HOMEBREW_CELLAR, HOMEBREW_CACHE) with a fallback to the platform defaults.
+// If brewBin is set, the unset ones are asked to brew once instead (`brew --prefix`, `brew --cache`).
+// An error is returned if the cache directories can't be created.
+func Initialize(arch string, brewBin string) error {
+	dirPrefix := os.Getenv("HOMEBREW_PREFIX")
+	dirCellar := os.Getenv("HOMEBREW_CELLAR")
+	dirCaches := os.Getenv("HOMEBREW_CACHE")
 
-	if err != nil {
-		panic(err)
+	if len(dirPrefix) == 0 {
+		dirPrefix = askBrew(brewBin, "--prefix")
+	}
+
+	if len(dirPrefix) == 0 {
+		dirPrefix = getDefaultPrefix(arch)
 	}
 
-	dirCellar := "/usr/local/Cellar"
+	if len(dirCellar) == 0 {
+		dirCellar = filepath.Join(dirPrefix, "Cellar")
+	}
 
-	if arch == "arm64" && runtime.GOOS == "darwin" {
-		dirCellar = "/opt/homebrew/Cellar"
+	if len(dirCaches) == 0 {
+		dirCaches = askBrew(brewBin, "--cache")
+	}
+
+	if len(dirCaches) == 0 {
+		dirCaches = getDefaultCache()
 	}
 
 	instance = &Constant{
-		DirCellar:    dirCellar,
-		DirCaches:    dirHome + "/Library/Caches/Homebrew",
-		DirDownloads: dirHome + "/Library/Caches/Homebrew/downloads",
+		DirPrefix: dirPrefix,
+		DirCellar: dirCellar,
+		DirBrewc:  filepath.Join(dirCaches, "brewc"),
 	}
 
+	return SetCaches(dirCaches)
+}
+
+// SetCaches changes the cache directory (HOMEBREW_CACHE) of the bottles, the manifests and their aliases,
+// example: to fetch the bottles of another machine into a separate directory. DirBrewc isn't changed.
+// An error is returned if the directories can't be created, example: --dir /proc/nope
+func SetCaches(dirCaches string) error {
+	instance.DirCaches = dirCaches
+	instance.DirDownloads = filepath.Join(dirCaches, "downloads")
+
 	// create dirs
 	var dirs = []string{
 		instance.DirCaches,
@@ -47,10 +80,12 @@ func Initialize(arch string) {
 	}
 
 	for _, dir := range dirs {
-		if util.CreateDirIfNotExists(dir) != nil {
-			panic(fmt.Sprintf("Failed to create dir: %s", dir))
+		if err := util.CreateDirIfNotExists(dir); err != nil {
+			return fmt.Errorf("failed to create the cache directory: %w", err)
 		}
 	}
+
+	return nil
 }
 
 func Get() *Constant {
@@ -59,3 +94,52 @@ func Get() *Constant {
 	}
 	return instance
 }
+
+// getDefaultPrefix returns the default HOMEBREW_PREFIX of the platform.
+// example: /opt/homebrew, /usr/local, /home/linuxbrew/.linuxbrew
+func getDefaultPrefix(arch string) string {
+	if runtime.GOOS == "linux" {
+		return "/home/linuxbrew/.linuxbrew"
+	}
+
+	if arch == "arm64" {
+		return "/opt/homebrew"
+	}
+
+	return "/usr/local"
+}
+
+// getDefaultCache returns the default HOMEBREW_CACHE of the platform.
+// example: ~/Library/Caches/Homebrew, ~/.cache/Homebrew
+func getDefaultCache() string {
+	dirHome, err := os.UserHomeDir()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(dirHome, "Library", "Caches", "Homebrew")
+	}
+
+	if xdg := os.Getenv("XDG_CACHE_HOME"); len(xdg) > 0 {
+		return filepath.Join(xdg, "Homebrew")
+	}
+
+	return filepath.Join(dirHome, ".cache", "Homebrew")
+}
+
+// askBrew returns the output of `brew <flag>`, empty if brewBin is empty or the command fails.
+func askBrew(brewBin string, flag string) string {
+	if len(brewBin) == 0 {
+		return ""
+	}
+
+	out, err := util.Exec(brewBin, flag)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(out)
+}
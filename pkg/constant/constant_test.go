@@ -0,0 +1,47 @@
+package constant
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetCaches(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("HOMEBREW_PREFIX", filepath.Join(dir, "prefix"))
+	t.Setenv("HOMEBREW_CELLAR", "")
+	t.Setenv("HOMEBREW_CACHE", filepath.Join(dir, "cache"))
+
+	if err := Initialize("arm64", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// fetch --dir ./fetched
+	if err := SetCaches(filepath.Join(dir, "fetched")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Constant{
+		DirPrefix:    filepath.Join(dir, "prefix"),
+		DirCellar:    filepath.Join(dir, "prefix", "Cellar"),
+		DirCaches:    filepath.Join(dir, "fetched"),
+		DirDownloads: filepath.Join(dir, "fetched", "downloads"),
+		DirBrewc:     filepath.Join(dir, "cache", "brewc"),
+	}
+
+	if *Get() != want {
+		t.Fatalf("got %+v, want %+v", *Get(), want)
+	}
+
+	// under a file
+	file := filepath.Join(dir, "file")
+
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetCaches(filepath.Join(file, "nope")); err == nil {
+		t.Fatal("expected an error for a directory that can't be created")
+	}
+}
@@ -0,0 +1,455 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+	"github.com/hamza72x/brewc/pkg/models/manifest"
+	"github.com/hamza72x/brewc/pkg/registry"
+	"github.com/hamza72x/brewc/pkg/retry"
+	"github.com/hamza72x/brewc/pkg/util"
+	col "github.com/hamza72x/go-color"
+)
+
+// Downloader downloads the bottles of formulae into brew's download cache,
+// so that `brew install` finds them there and only has to pour.
+type Downloader struct {
+	// threads is the number of bottles downloaded at the same time.
+	threads int
+
+	// platform is the bottle tag, example: arm64_ventura, x86_64_linux
+	platform string
+
+	verbose bool
+
+	// registry makes the authenticated requests to ghcr.io
+	registry *registry.Client
+
+	// policy retries the failed downloads
+	policy *retry.Policy
+}
+
+// New returns a new Downloader instance.
+func New(threads int, platform string, verbose bool, registry *registry.Client, policy *retry.Policy) *Downloader {
+	if threads <= 0 {
+		threads = 5
+	}
+
+	if policy == nil {
+		policy = retry.DefaultPolicy()
+	}
+
+	return &Downloader{
+		threads:  threads,
+		platform: platform,
+		verbose:  verbose,
+		registry: registry,
+		policy:   policy,
+	}
+}
+
+// DownloadBottles downloads the bottles of the given formulae concurrently.
+// Formulae without a bottle for the platform, or with an existing cache, are skipped.
+// It returns the first error encountered, after all of the downloads have finished.
+func (d *Downloader) DownloadBottles(formulae []*formula.Formula) error {
+	return d.forEach(formulae, func(f *formula.Formula) error {
+		if err := d.DownloadBottle(f); err != nil {
+			fmt.Printf("%s Error downloading bottle (%s): %s\n", constant.RedArrow, f.Name, err.Error())
+			return err
+		}
+		return nil
+	})
+}
+
+// DownloadManifests downloads the bottle manifests of the given formulae concurrently.
+// It returns the first error encountered, after all of the downloads have finished.
+func (d *Downloader) DownloadManifests(formulae []*formula.Formula) error {
+	return d.forEach(formulae, func(f *formula.Formula) error {
+		if _, err := d.DownloadManifest(f); err != nil {
+			fmt.Printf("%s Error downloading manifest (%s): %s\n", constant.RedArrow, f.Name, err.Error())
+			return err
+		}
+		return nil
+	})
+}
+
+// FetchResult is the outcome of the fetch of a formula, see Fetch.
+type FetchResult struct {
+	// Duration is the time it took to download the manifest and the bottle of the formula
+	Duration time.Duration
+
+	Err error
+
+	// NoBottle is true if the formula has no bottle for the platform, nothing was downloaded for it.
+	NoBottle bool
+}
+
+// Fetch downloads the manifests and the bottles of the given formulae concurrently,
+// and returns the result of every formula, keyed by its name.
+func (d *Downloader) Fetch(formulae []*formula.Formula) map[string]*FetchResult {
+	var lock sync.Mutex
+	var results = make(map[string]*FetchResult)
+
+	d.forEach(formulae, func(f *formula.Formula) error {
+		result := &FetchResult{}
+
+		defer func() {
+			lock.Lock()
+			results[f.Name] = result
+			lock.Unlock()
+		}()
+
+		// not the message of DownloadBottle, the formula isn't installed on this machine.
+		if len(f.GetBottleUrl(d.platform)) == 0 {
+			fmt.Printf("%s No bottle for %s on %s, nothing to fetch\n", constant.BlueArrow, f.Name, d.platform)
+			result.NoBottle = true
+			return nil
+		}
+
+		start := time.Now()
+
+		_, err := d.DownloadManifest(f)
+
+		if err == nil {
+			err = d.DownloadBottle(f)
+		}
+
+		result.Duration = time.Since(start)
+		result.Err = err
+
+		if err != nil {
+			fmt.Printf("%s Error fetching %s: %s\n", constant.RedArrow, f.Name, err.Error())
+		}
+
+		return err
+	})
+
+	return results
+}
+
+// forEach calls fn for each of the formulae, at most d.threads at the same time.
+func (d *Downloader) forEach(formulae []*formula.Formula, fn func(*formula.Formula) error) error {
+	var wg sync.WaitGroup
+	var conn = make(chan int, d.threads)
+
+	var lock sync.Mutex
+	var firstErr error
+
+	for _, f := range formulae {
+		wg.Add(1)
+
+		go func(f *formula.Formula) {
+			conn <- 1
+
+			defer wg.Done()
+			defer func() { <-conn }()
+
+			if err := fn(f); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}(f)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// DownloadBottle downloads the bottle of the given formula into brew's download cache.
+func (d *Downloader) DownloadBottle(f *formula.Formula) error {
+	url := f.GetBottleUrl(d.platform)
+
+	// example: a formula without arm64_linux bottles
+	if len(url) == 0 {
+		fmt.Printf("%s No bottle for %s on %s, brew will build it from the source\n", constant.BlueArrow, f.Name, d.platform)
+		return nil
+	}
+
+	expected := f.GetBottleUrlData(d.platform).Sha256
+	path := f.GetBottleDownloadPath(d.platform)
+
+	if f.HasBottleDownloadCache(d.platform) {
+		actual, err := util.Sha256File(path)
+
+		if err == nil && (len(expected) == 0 || actual == expected) {
+			if d.verbose {
+				fmt.Printf("%s Already downloaded: %s\n", constant.BlueArrow, f.Name)
+			}
+			return util.CreateSymlink(path, f.GetBottleAliasPath(d.platform))
+		}
+
+		// a corrupted or truncated cache, it's removed and downloaded again.
+		fmt.Printf("%s Invalid cache of %s: %s\n", constant.RedArrow, f.Name, (&ChecksumError{Formula: f.Name, Expected: expected, Actual: actual}).Error())
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s Downloading: %s\n", constant.GreenArrow, col.Info(f.Name))
+
+	// every attempt resumes from the partial file of the previous one,
+	// so the retries only give up once the attempts stop making progress.
+	incomplete := util.IncompletePath(path)
+
+	err := d.policy.RunResumable(func() (bool, error) {
+		before := getFileSize(incomplete)
+		err := d.fetchBottle(f, url, path, expected)
+		return getFileSize(incomplete) > before, err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return util.CreateSymlink(path, f.GetBottleAliasPath(d.platform))
+}
+
+// fetchBottle makes a single attempt to download the bottle at the given url to the path.
+func (d *Downloader) fetchBottle(f *formula.Formula, url string, path string, expected string) error {
+	incomplete := util.IncompletePath(path)
+
+	// the bottle is hashed while it's being written, including the part of a previous run.
+	hash := sha256.New()
+	offset, err := hashPartialFile(incomplete, hash)
+
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 && d.verbose {
+		fmt.Printf("%s Resuming %s from %d bytes\n", constant.BlueArrow, f.Name, offset)
+	}
+
+	resp, err := d.getRange(url, offset)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && getRangeStart(resp) == offset:
+		// resuming
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable || resp.StatusCode == http.StatusPartialContent:
+		// the server ignored the range, or the partial file is unusable, so it's downloaded from the start.
+		if offset > 0 {
+			hash.Reset()
+			offset = 0
+
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+
+				if resp, err = d.getRange(url, 0); err != nil {
+					return err
+				}
+
+				defer resp.Body.Close()
+			}
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return retry.NewStatusError(resp)
+		}
+	default:
+		return retry.NewStatusError(resp)
+	}
+
+	// on a network error the partial file is kept, so that the next run can resume it.
+	if err := util.AppendFile(incomplete, io.TeeReader(resp.Body, hash), offset > 0); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); len(expected) > 0 && actual != expected {
+		os.Remove(incomplete)
+
+		// the partial file of a previous run may be the corrupted part, the bottle is downloaded once more from the start.
+		if offset > 0 {
+			fmt.Printf("%s Invalid partial download of %s, downloading it again from the start\n", constant.RedArrow, f.Name)
+			return d.fetchBottle(f, url, path, expected)
+		}
+
+		return &ChecksumError{Formula: f.Name, Expected: expected, Actual: actual}
+	}
+
+	return os.Rename(incomplete, path)
+}
+
+// getRange makes a GET request to the registry, starting from the given offset.
+func (d *Downloader) getRange(url string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	return d.registry.Do(req)
+}
+
+// hashPartialFile writes the content of the partial file at the given path to the hash,
+// and returns its size. A missing file has the size of 0.
+func hashPartialFile(path string, hash io.Writer) (int64, error) {
+	file, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	return io.Copy(hash, file)
+}
+
+// getFileSize returns the size of the file at the given path, 0 if it doesn't exist.
+func getFileSize(path string) int64 {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// getRangeStart returns the first byte of a partial response.
+// example: Content-Range: bytes 1000-1999/2000 => 1000
+func getRangeStart(resp *http.Response) int64 {
+	var start, end, size int64
+
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return -1
+	}
+
+	return start
+}
+
+// DownloadManifest downloads the bottle manifest (OCI image index) of the given formula
+// into brew's download cache, and returns the element of the platform.
+// An existing cache is decoded instead of being downloaded again.
+func (d *Downloader) DownloadManifest(f *formula.Formula) (*manifest.ManifestElement, error) {
+	if len(f.GetBottleUrl(d.platform)) == 0 {
+		return nil, nil
+	}
+
+	path := f.GetManifestDownloadPath()
+
+	if !f.HasManifestDownloadCache() {
+		if d.verbose {
+			fmt.Printf("%s Downloading manifest: %s\n", constant.BlueArrow, f.Name)
+		}
+
+		err := d.policy.Run(func() error {
+			resp, err := d.registry.Get(f.GetManifestUrl(), manifest.MediaType)
+
+			if err != nil {
+				return err
+			}
+
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return retry.NewStatusError(resp)
+			}
+
+			return util.WriteFile(path, resp.Body)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := readManifest(path)
+
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	el, err := m.GetElement(f.GetBottleTag(d.platform))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if expected := f.GetBottleUrlData(d.platform).Sha256; len(expected) > 0 && el.GetBottleDigest() != expected {
+		os.Remove(path)
+		return nil, fmt.Errorf("manifest of %s is for bottle %s, expected %s", f.Name, el.GetBottleDigest(), expected)
+	}
+
+	return el, util.CreateSymlink(path, f.GetManifestAliasPath())
+}
+
+// readManifest decodes the manifest at the given path.
+func readManifest(path string) (*manifest.Manifest, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var m manifest.Manifest
+
+	if err := json.NewDecoder(file).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// FindMissing returns the bottles and manifests of the given formulae missing from brew's download cache,
+// for the offline mode. A bottle that doesn't match its sha256 counts as missing.
+// example: bottle of ffmpeg (/path/to/the/bottle.tar.gz)
+func (d *Downloader) FindMissing(formulae []*formula.Formula) []string {
+	var missing []string
+
+	for _, f := range formulae {
+		data := f.GetBottleUrlData(d.platform)
+
+		// brew builds it from the source
+		if len(data.URL) == 0 {
+			continue
+		}
+
+		if !f.HasManifestDownloadCache() {
+			missing = append(missing, fmt.Sprintf("manifest of %s (%s)", f.Name, f.GetManifestDownloadPath()))
+		}
+
+		path := f.GetBottleDownloadPath(d.platform)
+
+		if !f.HasBottleDownloadCache(d.platform) {
+			missing = append(missing, fmt.Sprintf("bottle of %s (%s)", f.Name, path))
+			continue
+		}
+
+		if actual, err := util.Sha256File(path); err != nil || (len(data.Sha256) > 0 && actual != data.Sha256) {
+			missing = append(missing, fmt.Sprintf("bottle of %s (%s, invalid sha256)", f.Name, path))
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,335 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models/formula"
+	"github.com/hamza72x/brewc/pkg/registry"
+	"github.com/hamza72x/brewc/pkg/retry"
+	"github.com/hamza72x/brewc/pkg/util"
+)
+
+const (
+	testTag    = "arm64_sonoma"
+	testBottle = "the content of the bottle"
+)
+
+// standIn is a stand-in registry, it records the `Range` header of every bottle request.
+type standIn struct {
+	server *httptest.Server
+
+	lock   sync.Mutex
+	ranges []string
+}
+
+// newDownloader returns a Downloader of the given handler, with brew's cache in a temporary directory.
+func newDownloader(t *testing.T, handler http.HandlerFunc) (*Downloader, *standIn) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	t.Setenv("HOMEBREW_PREFIX", filepath.Join(dir, "prefix"))
+	t.Setenv("HOMEBREW_CELLAR", filepath.Join(dir, "prefix", "Cellar"))
+	t.Setenv("HOMEBREW_CACHE", filepath.Join(dir, "cache"))
+
+	if err := constant.Initialize("arm64", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &standIn{}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") {
+			s.lock.Lock()
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+			s.lock.Unlock()
+		}
+
+		handler(w, r)
+	}))
+
+	t.Cleanup(s.server.Close)
+
+	policy := &retry.Policy{Attempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	return New(1, testTag, false, registry.New(s.server.URL, s.server.Client()), policy), s
+}
+
+// getRanges returns the `Range` headers of the bottle requests so far.
+func (s *standIn) getRanges() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.ranges...)
+}
+
+// newFormula returns a formula with a bottle of the given content for testTag.
+func newFormula(content string) *formula.Formula {
+	sha := util.Sha256(content)
+
+	return &formula.Formula{
+		Name:     "foo",
+		Versions: formula.Versions{Stable: "1.0"},
+		Bottle: formula.Bottle{Stable: formula.BottleStable{Files: formula.Files{
+			testTag: {URL: "https://ghcr.io/v2/homebrew/core/foo/blobs/sha256:" + sha, Sha256: sha},
+		}}},
+	}
+}
+
+// serveBottle writes the bottle, honoring the `Range` header.
+func serveBottle(w http.ResponseWriter, r *http.Request, content string) {
+	var start int
+
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil || start == 0 {
+		w.Write([]byte(content))
+		return
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write([]byte(content[start:]))
+}
+
+// writePartial writes the partial file of a previous run of the bottle.
+func writePartial(t *testing.T, f *formula.Formula, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(util.IncompletePath(f.GetBottleDownloadPath(testTag)), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkBottle makes sure the bottle is complete, and its partial file is gone.
+func checkBottle(t *testing.T, f *formula.Formula) {
+	t.Helper()
+
+	path := f.GetBottleDownloadPath(testTag)
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != testBottle {
+		t.Fatalf("bottle is %q, want %q", data, testBottle)
+	}
+
+	if util.DoesFileExist(util.IncompletePath(path)) {
+		t.Fatal("the partial file is left")
+	}
+
+	if _, err := os.Lstat(f.GetBottleAliasPath(testTag)); err != nil {
+		t.Fatalf("no alias of the bottle: %s", err)
+	}
+}
+
+func TestDownloadBottleResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial string
+		handler http.HandlerFunc
+		ranges  []string
+	}{
+		{
+			name:    "resumed",
+			partial: testBottle[:4],
+			handler: func(w http.ResponseWriter, r *http.Request) { serveBottle(w, r, testBottle) },
+			ranges:  []string{"bytes=4-"},
+		},
+		{
+			name:    "range ignored",
+			partial: testBottle[:4],
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(testBottle)) },
+			ranges:  []string{"bytes=4-"},
+		},
+		{
+			name:    "wrong range start",
+			partial: testBottle[:4],
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if len(r.Header.Get("Range")) == 0 {
+					w.Write([]byte(testBottle))
+					return
+				}
+
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 2-%d/%d", len(testBottle)-1, len(testBottle)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(testBottle[2:]))
+			},
+			ranges: []string{"bytes=4-", ""},
+		},
+		{
+			name:    "range not satisfiable",
+			partial: testBottle + "garbage",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if len(r.Header.Get("Range")) > 0 {
+					w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+
+				w.Write([]byte(testBottle))
+			},
+			ranges: []string{fmt.Sprintf("bytes=%d-", len(testBottle)+7), ""},
+		},
+		{
+			name:    "corrupted partial file",
+			partial: "XXXX",
+			handler: func(w http.ResponseWriter, r *http.Request) { serveBottle(w, r, testBottle) },
+			ranges:  []string{"bytes=4-", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, s := newDownloader(t, tt.handler)
+			f := newFormula(testBottle)
+
+			writePartial(t, f, tt.partial)
+
+			if err := d.DownloadBottle(f); err != nil {
+				t.Fatal(err)
+			}
+
+			checkBottle(t, f)
+
+			if ranges := s.getRanges(); !reflect.DeepEqual(ranges, tt.ranges) {
+				t.Fatalf("requested ranges %q, want %q", ranges, tt.ranges)
+			}
+		})
+	}
+}
+
+func TestDownloadBottleCorruptedAgain(t *testing.T) {
+	// the bottle is corrupted on the server, the restart from the start fails too.
+	d, s := newDownloader(t, func(w http.ResponseWriter, r *http.Request) { serveBottle(w, r, "corrupted content") })
+	f := newFormula(testBottle)
+
+	writePartial(t, f, testBottle[:4])
+
+	var checksumErr *ChecksumError
+
+	if err := d.DownloadBottle(f); !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a *ChecksumError, got %v", err)
+	}
+
+	// not retried, a checksum mismatch isn't retryable
+	if ranges := s.getRanges(); !reflect.DeepEqual(ranges, []string{"bytes=4-", ""}) {
+		t.Fatalf("requested ranges %q", ranges)
+	}
+}
+
+func TestDownloadBottleCorruptedCache(t *testing.T) {
+	d, s := newDownloader(t, func(w http.ResponseWriter, r *http.Request) { serveBottle(w, r, testBottle) })
+	f := newFormula(testBottle)
+
+	// a truncated bottle of a previous run
+	if err := os.WriteFile(f.GetBottleDownloadPath(testTag), []byte(testBottle[:4]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DownloadBottle(f); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBottle(t, f)
+
+	if ranges := s.getRanges(); !reflect.DeepEqual(ranges, []string{""}) {
+		t.Fatalf("requested ranges %q, want a single download", ranges)
+	}
+
+	// a valid cache isn't downloaded again
+	if err := d.DownloadBottle(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if ranges := s.getRanges(); len(ranges) != 1 {
+		t.Fatalf("requested ranges %q, want a single download", ranges)
+	}
+}
+
+func TestDownloadBottleChecksumError(t *testing.T) {
+	const served = "a truncated bottle"
+
+	d, _ := newDownloader(t, func(w http.ResponseWriter, r *http.Request) { serveBottle(w, r, served) })
+	f := newFormula(testBottle)
+
+	err := d.DownloadBottle(f)
+
+	var checksumErr *ChecksumError
+
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a *ChecksumError, got %v", err)
+	}
+
+	want := ChecksumError{Formula: "foo", Expected: util.Sha256(testBottle), Actual: util.Sha256(served)}
+
+	if *checksumErr != want {
+		t.Fatalf("got %+v, want %+v", *checksumErr, want)
+	}
+
+	path := f.GetBottleDownloadPath(testTag)
+
+	if util.DoesFileExist(path) || util.DoesFileExist(util.IncompletePath(path)) {
+		t.Fatal("the invalid bottle is left in the cache")
+	}
+}
+
+// serveManifest returns a handler of the manifest of newFormula, for a bottle of the given sha256.
+func serveManifest(digest string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/homebrew/core/foo/manifests/1.0" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintf(w, `{"schemaVersion": 2, "manifests": [{"platform": {"architecture": "arm64", "os": "darwin"},
+			"annotations": {"org.opencontainers.image.ref.name": "1.0.%s", "sh.brew.bottle.digest": "%s"}}]}`, testTag, digest)
+	}
+}
+
+func TestDownloadManifest(t *testing.T) {
+	d, _ := newDownloader(t, serveManifest(util.Sha256(testBottle)))
+	f := newFormula(testBottle)
+
+	el, err := d.DownloadManifest(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if el.GetBottleDigest() != util.Sha256(testBottle) {
+		t.Fatalf("element of bottle %s", el.GetBottleDigest())
+	}
+
+	if !f.HasManifestDownloadCache() {
+		t.Fatal("the manifest isn't cached")
+	}
+
+	if _, err := os.Lstat(f.GetManifestAliasPath()); err != nil {
+		t.Fatalf("no alias of the manifest: %s", err)
+	}
+}
+
+func TestDownloadManifestDigestMismatch(t *testing.T) {
+	// the manifest of another build of the bottle
+	d, _ := newDownloader(t, serveManifest(util.Sha256("another bottle")))
+	f := newFormula(testBottle)
+
+	if _, err := d.DownloadManifest(f); err == nil || !strings.Contains(err.Error(), util.Sha256("another bottle")) {
+		t.Fatalf("expected a digest mismatch, got %v", err)
+	}
+
+	if f.HasManifestDownloadCache() {
+		t.Fatal("the mismatched manifest is left in the cache")
+	}
+}
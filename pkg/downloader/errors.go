@@ -0,0 +1,14 @@
+package downloader
+
+import "fmt"
+
+// ChecksumError is returned when a bottle doesn't match the sha256 of the formula metadata.
+type ChecksumError struct {
+	Formula  string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sha256 mismatch for bottle of %s: expected %s, got %s", e.Formula, e.Expected, e.Actual)
+}
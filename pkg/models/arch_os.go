@@ -2,113 +2,191 @@ package models
 
 import (
 	"fmt"
-	"runtime"
+	"strconv"
 	"strings"
-
-	"github.com/hamza72x/brewc/pkg/util"
-	col "github.com/hamza72x/go-color"
 )
 
 // ArchAndCodeName represents the architecture and os version.
-// used in brew files like: arm64_ventura, arm64_monterey, arm64_big_sur, ventura, monterey, big_sur, x86_64_linux
+// used in brew files like: arm64_ventura, arm64_monterey, arm64_big_sur, ventura, monterey, big_sur, x86_64_linux, arm64_linux
 type ArchAndCodeName struct {
 	Architecture string
 	CodeName     string
 }
 
 const (
-	Arm64   = "arm64"
-	Aarch64 = "aarch64"
-	X86_64  = "x86_64"
+	Arm64  = "arm64"
+	X86_64 = "x86_64"
 )
 
 const (
+	Tahoe    = "tahoe"
+	Sequoia  = "sequoia"
+	Sonoma   = "sonoma"
 	Ventura  = "ventura"
 	Monterey = "monterey"
 	BigSur   = "big_sur"
+	Catalina = "catalina"
 	Linux    = "linux"
+
+	// All is the bottle tag of the bottles that work on every platform.
+	All = "all"
 )
 
+// MacOSRelease is a macOS version and its code name, as used in the bottle tags.
+type MacOSRelease struct {
+	Version  string
+	CodeName string
+}
+
 var (
-	macOsVersionToCodeName = map[string]string{
-		"13": Ventura,
-		"12": Monterey,
-		"11": BigSur,
+	// macOSReleases lists the known macOS releases, newest first.
+	// a newer, unknown release is treated as the newest known one.
+	macOSReleases = []MacOSRelease{
+		{Version: "26", CodeName: Tahoe},
+		{Version: "15", CodeName: Sequoia},
+		{Version: "14", CodeName: Sonoma},
+		{Version: "13", CodeName: Ventura},
+		{Version: "12", CodeName: Monterey},
+		{Version: "11", CodeName: BigSur},
+		{Version: "10.15", CodeName: Catalina},
 	}
 )
 
-func GetArchAndOSName() *ArchAndCodeName {
-	data := &ArchAndCodeName{
-		Architecture: getArchName(),
-		CodeName:     getOSCodeName(),
+// Name returns the name of the arch and os.
+// example: arm64_ventura, arm64_monterey, arm64_big_sur, x86_64_linux, arm64_linux
+func (a *ArchAndCodeName) Name() string {
+	full := a.Architecture + "_" + a.CodeName
+
+	// the intel macOS tags have no architecture prefix, example: ventura
+	if a.CodeName != Linux && a.Architecture == X86_64 {
+		return a.CodeName
 	}
 
-	if data.Architecture == Arm64 && data.CodeName == Linux {
-		panic("arm64 linux is not supported yet")
+	return full
+}
+
+// ParsePlatform returns the platform of the given bottle tag.
+// example: arm64_sonoma => arm64, sonoma; ventura => x86_64, ventura; x86_64_linux => x86_64, linux
+func ParsePlatform(tag string) (*ArchAndCodeName, error) {
+	switch tag {
+	case Arm64 + "_" + Linux:
+		return &ArchAndCodeName{Architecture: Arm64, CodeName: Linux}, nil
+	case X86_64 + "_" + Linux:
+		return &ArchAndCodeName{Architecture: X86_64, CodeName: Linux}, nil
 	}
 
-	fmt.Printf("%s: %s\n", col.Green("Platform"), data.Name())
+	arch := X86_64
+	codeName := tag
 
-	return data
-}
+	if strings.HasPrefix(tag, Arm64+"_") {
+		arch = Arm64
+		codeName = strings.TrimPrefix(tag, Arm64+"_")
+	}
 
-// Name returns the name of the arch and os.
-// example: arm64_ventura, arm64_monterey, arm64_big_sur, x86_64_linux
-func (a *ArchAndCodeName) Name() string {
-	full := a.Architecture + "_" + a.CodeName
+	for _, release := range macOSReleases {
+		if release.CodeName != codeName {
+			continue
+		}
 
-	if runtime.GOOS == "darwin" {
-		if a.Architecture == Arm64 {
-			return full
+		if arch == Arm64 && !hasArm64Bottles(codeName) {
+			return nil, fmt.Errorf("unknown platform: %s, apple silicon bottles start with %s", tag, BigSur)
 		}
-		return a.CodeName
+
+		return &ArchAndCodeName{Architecture: arch, CodeName: codeName}, nil
 	}
 
-	return full
+	return nil, fmt.Errorf("unknown platform: %s (example: arm64_sonoma, ventura, x86_64_linux)", tag)
 }
 
-// getArchName returns the arch name.
-// example: arm64, x86_64
-func getArchName() string {
+// GetMacOSCodeName returns the code name of the given macOS version.
+// example: 13.4.1 => ventura, 10.15.7 => catalina
+// A version newer than every known release returns the newest known code name.
+func GetMacOSCodeName(version string) (string, bool) {
+	parts := strings.Split(version, ".")
+
+	major, err := strconv.Atoi(parts[0])
 
-	archs := []string{"arm64", "aarch64", "x86_64"}
+	if err != nil {
+		return "", false
+	}
+
+	// before big_sur, the minor version was the release: 10.15
+	if major == 10 && len(parts) > 1 {
+		for _, release := range macOSReleases {
+			if release.Version == parts[0]+"."+parts[1] {
+				return release.CodeName, true
+			}
+		}
+		return "", false
+	}
 
-	arch := strings.ToLower(util.ExecMustWithTrim("uname", "-m"))
+	newest, _ := strconv.Atoi(macOSReleases[0].Version)
 
-	// if arch is aarch64, change it to arm64
-	if arch == "aarch64" {
-		arch = "arm64"
+	if major > newest {
+		return macOSReleases[0].CodeName, true
 	}
 
-	if !util.StrContains(archs, arch) {
-		panic("unknown arch: " + arch)
+	for _, release := range macOSReleases {
+		if release.Version == parts[0] {
+			return release.CodeName, true
+		}
 	}
 
-	return arch
+	return "", false
 }
 
-// getOSCodeName returns the os name.
-// example: ventura, monterey, big_sur, linux
-func getOSCodeName() string {
+// IsMacOSOlder returns true if the macOS release of the first code name is older than the second one.
+// example: catalina, big_sur => true. An unknown code name counts as older than every known release.
+func IsMacOSOlder(codeName string, than string) bool {
+	return getMacOSIndex(codeName) > getMacOSIndex(than)
+}
 
-	versions := []string{"ventura", "monterey", "big_sur", "linux"}
+// getMacOSIndex returns the index of the code name in macOSReleases (0 is the newest),
+// an unknown code name is after the oldest release.
+func getMacOSIndex(codeName string) int {
+	for i, release := range macOSReleases {
+		if release.CodeName == codeName {
+			return i
+		}
+	}
+	return len(macOSReleases)
+}
 
-	os := strings.ToLower(util.ExecMustWithTrim("uname", "-s"))
+// hasArm64Bottles returns true if the macOS release has apple silicon bottles, big_sur and newer.
+func hasArm64Bottles(codeName string) bool {
+	return !IsMacOSOlder(codeName, BigSur)
+}
 
-	if os == "darwin" {
-		versionFull := util.ExecMustWithTrim("sw_vers", "-productVersion")
-		version := strings.Split(versionFull, ".")
+// GetBottleTagCandidates returns the bottle tags usable on the platform of the given tag,
+// in the order Homebrew prefers them: the exact tag, the `all` tag,
+// then the tags of the older macOS releases of the same architecture.
+// example: arm64_sonoma => arm64_sonoma, all, arm64_ventura, arm64_monterey, arm64_big_sur
+func GetBottleTagCandidates(tag string) []string {
+	var candidates = []string{tag, All}
 
-		if len(version) < 2 {
-			panic("unknown os version: " + versionFull)
-		}
+	prefix := ""
+	codeName := tag
 
-		os = macOsVersionToCodeName[version[0]]
+	if strings.HasPrefix(tag, Arm64+"_") {
+		prefix = Arm64 + "_"
+		codeName = strings.TrimPrefix(tag, prefix)
 	}
 
-	if !util.StrContains(versions, os) {
-		panic("unknown os version: " + os)
+	older := false
+
+	for _, release := range macOSReleases {
+		if len(prefix) > 0 && !hasArm64Bottles(release.CodeName) {
+			break
+		}
+
+		if older {
+			candidates = append(candidates, prefix+release.CodeName)
+		}
+
+		if release.CodeName == codeName {
+			older = true
+		}
 	}
 
-	return os
+	return candidates
 }
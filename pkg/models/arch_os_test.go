@@ -0,0 +1,64 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want *ArchAndCodeName
+	}{
+		{"arm64_sonoma", &ArchAndCodeName{Architecture: Arm64, CodeName: Sonoma}},
+		{"arm64_big_sur", &ArchAndCodeName{Architecture: Arm64, CodeName: BigSur}},
+		{"catalina", &ArchAndCodeName{Architecture: X86_64, CodeName: Catalina}},
+		{"x86_64_linux", &ArchAndCodeName{Architecture: X86_64, CodeName: Linux}},
+		{"arm64_linux", &ArchAndCodeName{Architecture: Arm64, CodeName: Linux}},
+		// there are no apple silicon bottles before big_sur
+		{"arm64_catalina", nil},
+		{"arm64_windows", nil},
+		{"x86_64_sonoma", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePlatform(tt.tag)
+
+		if tt.want == nil {
+			if err == nil {
+				t.Fatalf("%s: expected an error, got %+v", tt.tag, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s", tt.tag, err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.tag, got, tt.want)
+		}
+
+		if got.Name() != tt.tag {
+			t.Fatalf("%s: named %s", tt.tag, got.Name())
+		}
+	}
+}
+
+func TestGetBottleTagCandidates(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"arm64_ventura", []string{"arm64_ventura", All, "arm64_monterey", "arm64_big_sur"}},
+		{"arm64_big_sur", []string{"arm64_big_sur", All}},
+		{"monterey", []string{"monterey", All, "big_sur", "catalina"}},
+		{"x86_64_linux", []string{"x86_64_linux", All}},
+	}
+
+	for _, tt := range tests {
+		if got := GetBottleTagCandidates(tt.tag); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type OptionalArgs struct {
 	Verbose bool
 	Threads int
@@ -9,4 +11,69 @@ type OptionalArgs struct {
 
 	// DeleteAllNestedDependencies is a flag to delete all sub-dependencies after uninstalling a formula (it will delete all nested unused dependencies).
 	DeleteAllNestedDependencies bool
+
+	// KeepGoing is a flag to continue with the resolved formulae when some of the dependencies couldn't be resolved.
+	KeepGoing bool
+
+	// RegistryURL is the base url of the registry the bottles are downloaded from.
+	// default is https://ghcr.io, it can point to a local stand-in registry.
+	RegistryURL string
+
+	// FormulaIndex is a flag to download the full formula index once (and reuse it while it's not modified),
+	// instead of one request per formula.
+	FormulaIndex bool
+
+	// Platform overrides the detected platform, it's a bottle tag, example: arm64_sonoma
+	Platform string
+
+	// IncludeBuild is a flag to include the build dependencies, example: for --build-from-source installs
+	IncludeBuild bool
+
+	// IncludeTest is a flag to include the test dependencies, example: for `brew test` in CI
+	IncludeTest bool
+
+	// IncludeOptional is a flag to include the optional dependencies.
+	IncludeOptional bool
+
+	// SkipRecommended is a flag to leave out the recommended dependencies, they are included by default like brew does.
+	SkipRecommended bool
+
+	// Depth is the depth of the dependencies printed by the deps command, 0 means all of them.
+	Depth int
+
+	// Format is the output format of the deps (tree, flat, dot or json) and uses (list or json) commands,
+	// empty for the default one.
+	Format string
+
+	// Recursive is a flag of the uses command, to include the formulae depending on a formula through other formulae.
+	Recursive bool
+
+	// Annotate is a flag to print the install state of every formula: installed, outdated or missing
+	Annotate bool
+
+	// FetchDir is the directory the fetch command downloads into, laid out like brew's cache.
+	// default is empty, brew's cache
+	FetchDir string
+
+	// Brew is the path of the brew binary, it's looked up when empty.
+	Brew string
+
+	// AskBrew is a flag to ask brew for its prefix and cache (`brew --prefix`, `brew --cache`),
+	// when they are not set with HOMEBREW_PREFIX and HOMEBREW_CACHE.
+	AskBrew bool
+
+	// Offline is a flag to resolve and install only from the local caches, without any network request.
+	Offline bool
+
+	// RetryAttempts is the maximum number of attempts of a network operation.
+	RetryAttempts int
+
+	// RetryBackoff is the base wait between two attempts, it grows exponentially.
+	RetryBackoff time.Duration
+
+	// RetryMaxElapsed stops retrying a network operation once it took this long.
+	RetryMaxElapsed time.Duration
+
+	// RetryTimeout is the timeout of a single attempt of a formula request.
+	RetryTimeout time.Duration
 }
@@ -0,0 +1,45 @@
+package formula
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormulaError is the error of a single formula while resolving the dependencies.
+type FormulaError struct {
+	Name string
+	Err  error
+}
+
+func (e *FormulaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err.Error())
+}
+
+func (e *FormulaError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveError lists every formula that failed while resolving the dependencies.
+type ResolveError struct {
+	Errors []*FormulaError
+}
+
+func (e *ResolveError) Error() string {
+	var lines = make([]string, len(e.Errors))
+
+	for i, err := range e.Errors {
+		lines[i] = "  " + err.Error()
+	}
+
+	return fmt.Sprintf("failed to resolve %d formulae:\n%s", len(e.Errors), strings.Join(lines, "\n"))
+}
+
+// CycleError is returned when the dependencies of a formula form a cycle.
+type CycleError struct {
+	// Cycle is the path of the cycle, the first formula is repeated at the end.
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(e.Cycle, " -> "))
+}
@@ -2,8 +2,11 @@ package formula
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/hamza72x/brewc/pkg/cellar"
 	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/models"
 	"github.com/hamza72x/brewc/pkg/util"
 )
 
@@ -11,31 +14,35 @@ import (
 // GET https://formulae.brew.sh/api/formula/${FORMULA}.json
 // Example: curl -sL https://formulae.brew.sh/api/formula/ffmpeg.json | jq
 type Formula struct {
-	Name                    string    `json:"name"`
-	FullName                string    `json:"full_name"`
-	Tap                     string    `json:"tap"`
-	Desc                    string    `json:"desc"`
-	Versions                Versions  `json:"versions"`
-	Urls                    Urls      `json:"urls"`
-	Revision                int64     `json:"revision"`
-	VersionScheme           int64     `json:"version_scheme"`
-	Bottle                  Bottle    `json:"bottle"`
-	BuildDependencies       []string  `json:"build_dependencies"`
-	Dependencies            []string  `json:"dependencies"`
-	TestDependencies        *[]string `json:"test_dependencies"`
-	RecommendedDependencies *[]string `json:"recommended_dependencies"`
-	OptionalDependencies    *[]string `json:"optional_dependencies"`
-	Requirements            *[]string `json:"requirements"`
-	ConflictsWith           *[]string `json:"conflicts_with"`
-	Caveats                 *string   `json:"caveats"`
-	Outdated                bool      `json:"outdated"`
-	Deprecated              bool      `json:"deprecated"`
-	DeprecationDate         *string   `json:"deprecation_date"`
-	DeprecationReason       *string   `json:"deprecation_reason"`
-	Disabled                bool      `json:"disabled"`
-	DisableDate             *string   `json:"disable_date"`
-	DisableReason           *string   `json:"disable_reason"`
-	GeneratedDate           string    `json:"generated_date"`
+	Name                    string                `json:"name"`
+	FullName                string                `json:"full_name"`
+	Tap                     string                `json:"tap"`
+	Aliases                 []string              `json:"aliases"`
+	Desc                    string                `json:"desc"`
+	Versions                Versions              `json:"versions"`
+	Urls                    Urls                  `json:"urls"`
+	Revision                int64                 `json:"revision"`
+	VersionScheme           int64                 `json:"version_scheme"`
+	Bottle                  Bottle                `json:"bottle"`
+	BuildDependencies       []string              `json:"build_dependencies"`
+	Dependencies            []string              `json:"dependencies"`
+	TestDependencies        *[]string             `json:"test_dependencies"`
+	RecommendedDependencies *[]string             `json:"recommended_dependencies"`
+	OptionalDependencies    *[]string             `json:"optional_dependencies"`
+	Requirements            *[]string             `json:"requirements"`
+	ConflictsWith           *[]string             `json:"conflicts_with"`
+	Caveats                 *string               `json:"caveats"`
+	Outdated                bool                  `json:"outdated"`
+	Deprecated              bool                  `json:"deprecated"`
+	DeprecationDate         *string               `json:"deprecation_date"`
+	DeprecationReason       *string               `json:"deprecation_reason"`
+	Disabled                bool                  `json:"disabled"`
+	DisableDate             *string               `json:"disable_date"`
+	DisableReason           *string               `json:"disable_reason"`
+	GeneratedDate           string                `json:"generated_date"`
+	UsesFromMacos           []UsesFromMacoElement `json:"uses_from_macos"`
+	UsesFromMacosBounds     []UsesFromMacosBound  `json:"uses_from_macos_bounds"`
+	Variations              Variations            `json:"variations"`
 }
 
 type Analytics struct {
@@ -77,15 +84,9 @@ type BottleStable struct {
 	Files   Files  `json:"files"`
 }
 
-type Files struct {
-	Arm64Ventura  BottleUrlData `json:"arm64_ventura"`
-	Arm64Monterey BottleUrlData `json:"arm64_monterey"`
-	Arm64BigSur   BottleUrlData `json:"arm64_big_sur"`
-	Ventura       BottleUrlData `json:"ventura"`
-	Monterey      BottleUrlData `json:"monterey"`
-	BigSur        BottleUrlData `json:"big_sur"`
-	X8664_Linux   BottleUrlData `json:"x86_64_linux"`
-}
+// Files are the bottles of the formula.
+// key string: bottle tag, example: arm64_sonoma, ventura, x86_64_linux, all
+type Files map[string]BottleUrlData
 
 type BottleUrlData struct {
 	Cellar string `json:"cellar"`
@@ -110,17 +111,19 @@ type UrlsStable struct {
 	Checksum string  `json:"checksum"`
 }
 
-type UsesFromMacoClass struct {
-	Gperf  *string `json:"gperf,omitempty"`
-	Python *string `json:"python,omitempty"`
-}
-
-type Variations struct {
-	X8664_Linux X8664_Linux `json:"x86_64_linux"`
-}
-
-type X8664_Linux struct {
-	Dependencies []string `json:"dependencies"`
+// Variations are the differences of the formula on some of the platforms,
+// the fields missing from a variation are the same as the formula's.
+// key string: bottle tag, example: arm64_linux, x86_64_linux, ventura
+type Variations map[string]Variation
+
+type Variation struct {
+	BuildDependencies       *[]string              `json:"build_dependencies"`
+	Dependencies            *[]string              `json:"dependencies"`
+	TestDependencies        *[]string              `json:"test_dependencies"`
+	RecommendedDependencies *[]string              `json:"recommended_dependencies"`
+	OptionalDependencies    *[]string              `json:"optional_dependencies"`
+	UsesFromMacos           *[]UsesFromMacoElement `json:"uses_from_macos"`
+	UsesFromMacosBounds     *[]UsesFromMacosBound  `json:"uses_from_macos_bounds"`
 }
 
 type Versions struct {
@@ -129,46 +132,65 @@ type Versions struct {
 	Bottle bool   `json:"bottle"`
 }
 
+// UsesFromMacoElement is a dependency provided by macOS, brew only needs it on linux
+// (or on the macOS releases older than its bound, see UsesFromMacosBound).
+// in the json it's a name, example: "zlib", or a name and its types,
+// example: {"python": "build"}, {"python": ["build", "test"]}
 type UsesFromMacoElement struct {
-	String            *string
-	UsesFromMacoClass *UsesFromMacoClass
+	Name string
+
+	// Types is empty for a runtime dependency, example: [build], [build test]
+	Types []string
 }
 
-// IsInstalled returns true if the formula is installed
-// based on the folder existence of /usr/local/Cellar/{name}/{version}
-func (f *Formula) IsInstalled() bool {
-	dirInstalled := fmt.Sprintf("%s/%s/%s", constant.Get().DirCellar, f.Name, f.Versions.Stable)
+// UsesFromMacosBound is the bound of the uses_from_macos element at the same index.
+// example: {"since": "catalina"}, the dependency is needed before catalina. It's empty for no bound.
+type UsesFromMacosBound struct {
+	Since string `json:"since"`
+}
 
-	if f.Revision > 0 {
-		dirInstalled = fmt.Sprintf("%s/%s/%s_%d", constant.Get().DirCellar, f.Name, f.Versions.Stable, f.Revision)
+// IsInstalled returns true if there is nothing to install for the formula,
+// its current version is installed (see GetInstallState) or an older version is pinned.
+func (f *Formula) IsInstalled() bool {
+	switch f.GetInstallState() {
+	case cellar.Current:
+		return true
+	case cellar.Outdated:
+		return cellar.Get().Get(f.Name).Pinned
+	default:
+		return false
 	}
+}
 
-	return util.DoesDirExist(dirInstalled)
+// GetInstallState returns the install state of the formula,
+// based on the kegs in the Cellar: {DirCellar}/{name}/{version}[_{revision}]
+func (f *Formula) GetInstallState() cellar.State {
+	return cellar.Get().GetState(f.Name, f.PkgVersion())
 }
 
 // GetBottleUrl returns the bottle url of the formula
 // example: https://ghcr.io/v2/homebrew/core/libraw/blobs/sha256:81a83bd632b57ca84ce11f0829942a8061c7a57d3568e6c20c54c919fa2c6111
 func (f *Formula) GetBottleUrl(osCodeName string) string {
-	files := f.Bottle.Stable.Files
-
-	switch osCodeName {
-	case "arm64_ventura":
-		return files.Arm64Ventura.URL
-	case "arm64_monterey":
-		return files.Arm64Monterey.URL
-	case "arm64_big_sur":
-		return files.Arm64BigSur.URL
-	case "ventura":
-		return files.Ventura.URL
-	case "monterey":
-		return files.Monterey.URL
-	case "big_sur":
-		return files.BigSur.URL
-	case "x86_64_linux":
-		return files.X8664_Linux.URL
-	default:
-		panic(fmt.Sprintf("unknown os code name: %s", osCodeName))
+	return f.GetBottleUrlData(osCodeName).URL
+}
+
+// GetBottleUrlData returns the bottle file data (url, sha256, cellar) of the formula,
+// for the bottle tag chosen by GetBottleTag. It's empty if there is no usable bottle.
+func (f *Formula) GetBottleUrlData(osCodeName string) BottleUrlData {
+	return f.Bottle.Stable.Files[f.GetBottleTag(osCodeName)]
+}
+
+// GetBottleTag returns the tag of the bottle to use on the platform of the given tag,
+// following Homebrew's rules: the exact tag, the `all` bottle, or the bottle of an older macOS release.
+// example: on arm64_sequoia, a formula with only an arm64_sonoma bottle => arm64_sonoma
+// It's empty if there is no usable bottle, then brew builds the formula from the source.
+func (f *Formula) GetBottleTag(osCodeName string) string {
+	for _, tag := range models.GetBottleTagCandidates(osCodeName) {
+		if _, ok := f.Bottle.Stable.Files[tag]; ok {
+			return tag
+		}
 	}
+	return ""
 }
 
 // HasBottleDownloadCache returns true if the bottle download cache exists
@@ -186,24 +208,65 @@ func (f *Formula) GetBottleDownloadPath(osCodeName string) string {
 	// ff7fbec7b5a2946b14760f437f4e71201b7d0bdf2d68ebdcf4d308eece3e5061--luajit--2.1.0-beta3-20230104.2.ventura.bottle.tar.gz
 	// sha256_of_url--name--version.os_code_name.bottle.tar.gz
 
-	return fmt.Sprintf("%s/%s--%s--%s.%s.bottle.tar.gz", constant.Get().DirDownloads, string(url[:]), f.Name, f.Versions.Stable, osCodeName)
+	return fmt.Sprintf("%s/%s--%s", constant.Get().DirDownloads, string(url[:]), f.GetBottleFileName(osCodeName))
+}
+
+// GetBottleFileName returns the file name brew uses for the bottle
+// example: luajit--2.1.0-beta3-20230104.2.ventura.bottle.tar.gz
+// or with a rebuild: libvmaf--2.3.1_1.arm64_ventura.bottle.1.tar.gz
+func (f *Formula) GetBottleFileName(osCodeName string) string {
+	// the bottle of an older release, or the `all` bottle, is named after its own tag.
+	tag := f.GetBottleTag(osCodeName)
+
+	if f.Bottle.Stable.Rebuild > 0 {
+		return fmt.Sprintf("%s--%s.%s.bottle.%d.tar.gz", f.Name, f.PkgVersion(), tag, f.Bottle.Stable.Rebuild)
+	}
+
+	return fmt.Sprintf("%s--%s.%s.bottle.tar.gz", f.Name, f.PkgVersion(), tag)
 }
 
 // GetBottleAliasPath returns the alias path of the bottle
-// example: $HOMEBREW_DOWNLOADS_DIR/aribb24--1.0.4
-func (f *Formula) GetBottleAliasPath() string {
+// example: $HOMEBREW_CACHE/aribb24--1.0.4.ventura.bottle.tar.gz
+func (f *Formula) GetBottleAliasPath(osCodeName string) string {
 	// example:
-	// aribb24--1.0.4
-	// name--version
+	// aribb24--1.0.4.ventura.bottle.tar.gz
+	// name--version.os_code_name.bottle.tar.gz
+
+	return fmt.Sprintf("%s/%s", constant.Get().DirCaches, f.GetBottleFileName(osCodeName))
+}
+
+// PkgVersion returns the stable version including the revision, the way brew prints it
+// example: 2.3.1, 2.3.1_1
+func (f *Formula) PkgVersion() string {
+	if f.Revision > 0 {
+		return fmt.Sprintf("%s_%d", f.Versions.Stable, f.Revision)
+	}
 
-	return fmt.Sprintf("%s/%s--%s", constant.Get().DirCaches, f.Name, f.Versions.Stable)
+	return f.Versions.Stable
 }
 
 // GetManifestUrl returns the manifest url of the formula
 // example: https://ghcr.io/v2/homebrew/core/libraw/manifests/0.21.1
 func (f *Formula) GetManifestUrl() string {
 	// example: https://ghcr.io/v2/homebrew/core/libraw/manifests/0.21.1
-	return fmt.Sprintf("https://ghcr.io/v2/homebrew/core/%s/manifests/%s", f.Name, f.Versions.Stable)
+	return fmt.Sprintf("https://ghcr.io/v2/homebrew/core/%s/manifests/%s", f.GetImageName(), f.GetManifestVersion())
+}
+
+// GetImageName returns the name of the formula's package on ghcr.io
+// example: openssl@3 => openssl/3, libxml++ => libxmlxx
+func (f *Formula) GetImageName() string {
+	name := strings.Replace(strings.ToLower(f.Name), "@", "/", 1)
+	return strings.ReplaceAll(name, "+", "x")
+}
+
+// GetManifestVersion returns the version the manifest is tagged with
+// example: 2.3.1, 2.3.1_1 or with a rebuild: 2.3.1_1-1
+func (f *Formula) GetManifestVersion() string {
+	if f.Bottle.Stable.Rebuild > 0 {
+		return fmt.Sprintf("%s-%d", f.PkgVersion(), f.Bottle.Stable.Rebuild)
+	}
+
+	return f.PkgVersion()
 }
 
 // GetManifestDownloadPath returns the cache path of the manifest
@@ -215,7 +278,7 @@ func (f *Formula) GetManifestDownloadPath() string {
 	// dce2f2976851d7b9a08cc4fb5bcc12aab7cf40bbdfec362ef68672a15fa47e55--libvmaf-2.3.1.bottle_manifest.json
 	// sha256_of_url--name--version.bottle_manifest.json
 
-	return fmt.Sprintf("%s/%s--%s-%s.bottle_manifest.json", constant.Get().DirDownloads, url[:], f.Name, f.Versions.Stable)
+	return fmt.Sprintf("%s/%s--%s-%s.bottle_manifest.json", constant.Get().DirDownloads, url[:], f.Name, f.GetManifestVersion())
 }
 
 // GetManifestAliasPath returns the alias path of the manifest
@@ -224,7 +287,7 @@ func (f *Formula) GetManifestAliasPath() string {
 	// example:
 	// aribb24_bottle_manifest--1.0.4
 	// name_bottle_manifest--version
-	return fmt.Sprintf("%s/%s_bottle_manifest--%s", constant.Get().DirCaches, f.Name, f.Versions.Stable)
+	return fmt.Sprintf("%s/%s_bottle_manifest--%s", constant.Get().DirCaches, f.Name, f.GetManifestVersion())
 }
 
 // HasManifestDownloadCache returns true if the manifest download cache exists
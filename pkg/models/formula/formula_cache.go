@@ -0,0 +1,80 @@
+package formula
+
+import (
+	"sync"
+)
+
+// cache is the in-process cache of GetFormulaJSON, so that each formula is only downloaded once per run.
+var cache = newFormulaCache()
+
+// formulaCache memoizes the formulae by name.
+// Concurrent lookups of the same name share a single fetch (single-flight).
+type formulaCache struct {
+	// key string: formula name
+	entries map[string]*cacheEntry
+
+	hits   int
+	misses int
+
+	// lock is used to make the cache thread-safe
+	lock *sync.Mutex
+}
+
+// cacheEntry is a finished or in-flight fetch, done is closed once it's finished.
+type cacheEntry struct {
+	done    chan struct{}
+	formula *Formula
+	err     error
+}
+
+// CacheStats is the number of lookups served by the formula cache (hits) and by fetching (misses).
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+func newFormulaCache() *formulaCache {
+	return &formulaCache{
+		entries: make(map[string]*cacheEntry),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// GetCacheStats returns the statistics of the formula cache.
+func GetCacheStats() CacheStats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return CacheStats{Hits: cache.hits, Misses: cache.misses}
+}
+
+// get returns the cached formula, or calls fetch once for all of the concurrent callers.
+// failed fetches are not cached, the next call fetches again.
+func (c *formulaCache) get(name string, fetch func(string) (*Formula, error)) (*Formula, error) {
+	c.lock.Lock()
+
+	if entry, ok := c.entries[name]; ok {
+		c.hits++
+		c.lock.Unlock()
+
+		<-entry.done
+
+		return entry.formula, entry.err
+	}
+
+	entry := &cacheEntry{done: make(chan struct{})}
+	c.entries[name] = entry
+	c.misses++
+	c.lock.Unlock()
+
+	entry.formula, entry.err = fetch(name)
+	close(entry.done)
+
+	if entry.err != nil {
+		c.lock.Lock()
+		delete(c.entries, name)
+		c.lock.Unlock()
+	}
+
+	return entry.formula, entry.err
+}
@@ -0,0 +1,220 @@
+package formula
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hamza72x/brewc/pkg/models"
+)
+
+// DependencyKind is the kind of a dependency, the way brew tags them.
+type DependencyKind string
+
+const (
+	KindRuntime     DependencyKind = "runtime"
+	KindRecommended DependencyKind = "recommended"
+	KindOptional    DependencyKind = "optional"
+	KindBuild       DependencyKind = "build"
+	KindTest        DependencyKind = "test"
+)
+
+// Dependency is a dependency of a formula and its kind.
+type Dependency struct {
+	Name string
+	Kind DependencyKind
+}
+
+// UnmarshalJSON decodes a uses_from_macos element, a name or a map of a name to its type or list of types.
+func (e *UsesFromMacoElement) UnmarshalJSON(data []byte) error {
+	var name string
+
+	if err := json.Unmarshal(data, &name); err == nil {
+		*e = UsesFromMacoElement{Name: name}
+		return nil
+	}
+
+	var typed map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+
+	if len(typed) != 1 {
+		return fmt.Errorf("invalid uses_from_macos element: %s", string(data))
+	}
+
+	for name, raw := range typed {
+		var t string
+
+		if err := json.Unmarshal(raw, &t); err == nil {
+			*e = UsesFromMacoElement{Name: name, Types: []string{t}}
+			return nil
+		}
+
+		var types []string
+
+		if err := json.Unmarshal(raw, &types); err != nil {
+			return fmt.Errorf("invalid uses_from_macos element: %s", string(data))
+		}
+
+		*e = UsesFromMacoElement{Name: name, Types: types}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the element the same way the formula API does.
+func (e UsesFromMacoElement) MarshalJSON() ([]byte, error) {
+	switch len(e.Types) {
+	case 0:
+		return json.Marshal(e.Name)
+	case 1:
+		return json.Marshal(map[string]string{e.Name: e.Types[0]})
+	default:
+		return json.Marshal(map[string][]string{e.Name: e.Types})
+	}
+}
+
+// Kinds returns the kinds of the dependency, one for every known type, example: [build test]
+// runtime if it has no type.
+func (e *UsesFromMacoElement) Kinds() []DependencyKind {
+	if len(e.Types) == 0 {
+		return []DependencyKind{KindRuntime}
+	}
+
+	var kinds []DependencyKind
+
+	for _, t := range e.Types {
+		switch kind := DependencyKind(t); kind {
+		case KindBuild, KindTest, KindRecommended, KindOptional:
+			kinds = append(kinds, kind)
+		}
+	}
+
+	return kinds
+}
+
+// GetDependencies returns the runtime dependencies of the formula on the platform of the given bottle tag:
+// the dependencies of its variation (or the default ones), plus the uses_from_macos dependencies
+// the platform doesn't provide. An empty tag returns the default dependencies.
+// example: zlib on x86_64_linux, but not on arm64_sonoma
+func (f *Formula) GetDependencies(osCodeName string) []string {
+	v := f.Variations[osCodeName]
+
+	var deps = f.Dependencies
+
+	if v.Dependencies != nil {
+		deps = *v.Dependencies
+	}
+
+	if len(osCodeName) == 0 {
+		return deps
+	}
+
+	// a copy, the formula is shared between goroutines.
+	deps = append([]string{}, deps...)
+
+	var seen = make(map[string]bool, len(deps))
+
+	for _, dep := range deps {
+		seen[dep] = true
+	}
+
+	for _, dep := range f.getUsesFromMacos(osCodeName) {
+		if len(dep.Types) == 0 && !seen[dep.Name] {
+			seen[dep.Name] = true
+			deps = append(deps, dep.Name)
+		}
+	}
+
+	return deps
+}
+
+// GetAllDependencies returns the dependencies of every kind of the formula on the platform of the given bottle tag,
+// the runtime ones first (see GetDependencies), then the recommended, optional, build and test ones.
+// A dependency of more than one kind is only returned with the first of them.
+func (f *Formula) GetAllDependencies(osCodeName string) []Dependency {
+	v := f.Variations[osCodeName]
+
+	var all []Dependency
+	var seen = make(map[string]bool)
+
+	add := func(kind DependencyKind, names []string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				all = append(all, Dependency{Name: name, Kind: kind})
+			}
+		}
+	}
+
+	add(KindRuntime, f.GetDependencies(osCodeName))
+	add(KindRecommended, getVariationDeps(v.RecommendedDependencies, f.RecommendedDependencies))
+	add(KindOptional, getVariationDeps(v.OptionalDependencies, f.OptionalDependencies))
+	add(KindBuild, getVariationDeps(v.BuildDependencies, &f.BuildDependencies))
+	add(KindTest, getVariationDeps(v.TestDependencies, f.TestDependencies))
+
+	if len(osCodeName) == 0 {
+		return all
+	}
+
+	// the runtime ones are already in GetDependencies
+	for _, dep := range f.getUsesFromMacos(osCodeName) {
+		for _, kind := range dep.Kinds() {
+			add(kind, []string{dep.Name})
+		}
+	}
+
+	return all
+}
+
+// getVariationDeps returns the dependencies of the variation, or the default ones if the variation doesn't change them.
+func getVariationDeps(variation *[]string, deps *[]string) []string {
+	if variation != nil {
+		return *variation
+	}
+
+	if deps != nil {
+		return *deps
+	}
+
+	return nil
+}
+
+// getUsesFromMacos returns the uses_from_macos dependencies needed on the platform of the given bottle tag,
+// of every type: all of them on linux, on macOS only the ones bounded to a newer release.
+func (f *Formula) getUsesFromMacos(osCodeName string) []UsesFromMacoElement {
+	v := f.Variations[osCodeName]
+
+	var elements = f.UsesFromMacos
+	var bounds = f.UsesFromMacosBounds
+
+	if v.UsesFromMacos != nil {
+		elements = *v.UsesFromMacos
+	}
+
+	if v.UsesFromMacosBounds != nil {
+		bounds = *v.UsesFromMacosBounds
+	}
+
+	platform, err := models.ParsePlatform(osCodeName)
+
+	// an unknown platform is treated like a recent macOS, it provides them all.
+	if err != nil {
+		return nil
+	}
+
+	if platform.CodeName == models.Linux {
+		return elements
+	}
+
+	var needed []UsesFromMacoElement
+
+	for i, el := range elements {
+		if i < len(bounds) && models.IsMacOSOlder(platform.CodeName, bounds[i].Since) {
+			needed = append(needed, el)
+		}
+	}
+
+	return needed
+}
@@ -0,0 +1,86 @@
+package formula
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUsesFromMacoElementJSON(t *testing.T) {
+	tests := []struct {
+		data  string
+		want  UsesFromMacoElement
+		kinds []DependencyKind
+	}{
+		{`"zlib"`, UsesFromMacoElement{Name: "zlib"}, []DependencyKind{KindRuntime}},
+		{`{"python":"build"}`, UsesFromMacoElement{Name: "python", Types: []string{"build"}}, []DependencyKind{KindBuild}},
+		{`{"python":["build","test"]}`, UsesFromMacoElement{Name: "python", Types: []string{"build", "test"}}, []DependencyKind{KindBuild, KindTest}},
+	}
+
+	for _, tt := range tests {
+		var got UsesFromMacoElement
+
+		if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+			t.Fatalf("%s: %s", tt.data, err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.data, got, tt.want)
+		}
+
+		if kinds := got.Kinds(); !reflect.DeepEqual(kinds, tt.kinds) {
+			t.Fatalf("%s: kinds %v, want %v", tt.data, kinds, tt.kinds)
+		}
+
+		data, err := json.Marshal(got)
+
+		if err != nil || string(data) != tt.data {
+			t.Fatalf("%s: encoded as %s (%v)", tt.data, data, err)
+		}
+	}
+
+	for _, data := range []string{`{"python":1}`, `{"python":"build","perl":"build"}`, `["python"]`} {
+		var got UsesFromMacoElement
+
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Fatalf("%s: expected an error, got %+v", data, got)
+		}
+	}
+}
+
+func TestGetAllDependenciesUsesFromMacos(t *testing.T) {
+	var f Formula
+
+	data := `{
+		"name": "app",
+		"dependencies": ["openssl@3"],
+		"build_dependencies": ["pkgconf"],
+		"uses_from_macos": ["zlib", {"python": ["build", "test"]}, {"m4": "build"}, {"curl": "test"}],
+		"uses_from_macos_bounds": [{}, {}, {}, {}]
+	}`
+
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Dependency{
+		{Name: "openssl@3", Kind: KindRuntime},
+		{Name: "zlib", Kind: KindRuntime},
+		{Name: "pkgconf", Kind: KindBuild},
+		{Name: "python", Kind: KindBuild},
+		{Name: "m4", Kind: KindBuild},
+		{Name: "curl", Kind: KindTest},
+	}
+
+	if got := f.GetAllDependencies("x86_64_linux"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// macOS provides all of them
+	want = want[:1]
+	want = append(want, Dependency{Name: "pkgconf", Kind: KindBuild})
+
+	if got := f.GetAllDependencies("arm64_sonoma"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
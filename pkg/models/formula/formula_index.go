@@ -0,0 +1,170 @@
+package formula
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/retry"
+	"github.com/hamza72x/brewc/pkg/util"
+	col "github.com/hamza72x/go-color"
+)
+
+// indexClient downloads the formula index. It's several megabytes, so there is no overall timeout,
+// but a server that stalls before answering is given up on, and the request is retried.
+var indexClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// index serves the lookups of GetFormulaJSON when it's set, see UseIndex
+var index *FormulaIndex
+
+// FormulaIndex is the full formula index of the Homebrew JSON API.
+// GET https://formulae.brew.sh/api/formula.json
+type FormulaIndex struct {
+	// key string: formula name, full name or alias
+	formulae map[string]*Formula
+}
+
+// indexMeta is stored next to the index file, for the conditional requests.
+type indexMeta struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+// UseIndex makes GetFormulaJSON look the formulae up in the given index,
+// a formula missing from the index is still downloaded on its own.
+func UseIndex(idx *FormulaIndex) {
+	index = idx
+}
+
+// GetIndexPath returns the path of the cached formula index.
+// example: $HOMEBREW_CACHE/brewc/formula.json
+func GetIndexPath() string {
+	return filepath.Join(constant.Get().DirBrewc, "formula.json")
+}
+
+// LoadIndex downloads the formula index into GetIndexPath and decodes it.
+// The request is conditional (ETag / Last-Modified), the cached file is reused when it's not modified.
+func LoadIndex() (*FormulaIndex, error) {
+	path := GetIndexPath()
+
+	if err := util.CreateDirIfNotExists(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	var meta indexMeta
+
+	if util.DoesFileExist(path) {
+		readJSON(path+".meta", &meta)
+	}
+
+	err := retryPolicy.Run(func() error {
+		req, err := http.NewRequest(http.MethodGet, util.GetFormulaIndexURL(), nil)
+
+		if err != nil {
+			return err
+		}
+
+		if len(meta.ETag) > 0 {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+
+		if len(meta.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+
+		resp, err := indexClient.Do(req)
+
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			fmt.Fprintf(os.Stderr, "%s Formula index is up to date\n", constant.GreenArrow)
+			return nil
+		case http.StatusOK:
+			fmt.Fprintf(os.Stderr, "%s Downloading the formula index\n", constant.GreenArrow)
+		default:
+			return retry.NewStatusError(resp)
+		}
+
+		if err := util.WriteFile(path, resp.Body); err != nil {
+			return err
+		}
+
+		meta = indexMeta{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+
+		data, err := json.Marshal(meta)
+
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path+".meta", data, 0644)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadIndex(path)
+}
+
+// ReadIndex decodes the formula index at the given path.
+func ReadIndex(path string) (*FormulaIndex, error) {
+	var formulae []*Formula
+
+	if err := readJSON(path, &formulae); err != nil {
+		return nil, fmt.Errorf("invalid formula index %s: %w", path, err)
+	}
+
+	idx := &FormulaIndex{
+		formulae: make(map[string]*Formula, len(formulae)),
+	}
+
+	for _, f := range formulae {
+		for _, alias := range f.Aliases {
+			idx.formulae[alias] = f
+		}
+
+		idx.formulae[f.FullName] = f
+		idx.formulae[f.Name] = f
+	}
+
+	fmt.Fprintf(os.Stderr, "%s Formula index: %s formulae\n", constant.GreenArrow, col.Info(fmt.Sprint(len(formulae))))
+
+	return idx, nil
+}
+
+// Get returns the formula of the given name, full name or alias.
+func (idx *FormulaIndex) Get(name string) (*Formula, bool) {
+	f, ok := idx.formulae[name]
+	return f, ok
+}
+
+// readJSON decodes the json file at the given path into v.
+func readJSON(path string, v interface{}) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return json.NewDecoder(file).Decode(v)
+}
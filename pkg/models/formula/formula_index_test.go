@@ -0,0 +1,57 @@
+package formula
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLoadIndex(t *testing.T) {
+	useTestCache(t)
+
+	var lock sync.Mutex
+	var statuses []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.URL.Path != "/formula.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			statuses = append(statuses, http.StatusNotModified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		statuses = append(statuses, http.StatusOK)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`[{"name": "openssl@3", "full_name": "openssl@3", "aliases": ["openssl"], "versions": {"stable": "3.1.0"}}]`))
+	}))
+
+	defer server.Close()
+
+	t.Setenv("HOMEBREW_API_DOMAIN", server.URL)
+
+	// downloaded, then reused from the cache
+	for i := 0; i < 2; i++ {
+		idx, err := LoadIndex()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f, ok := idx.Get("openssl"); !ok || f.Versions.Stable != "3.1.0" {
+			t.Fatalf("openssl from the index: %+v, %v", f, ok)
+		}
+	}
+
+	if want := []int{http.StatusOK, http.StatusNotModified}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("statuses %v, want %v", statuses, want)
+	}
+}
@@ -1,45 +1,277 @@
 package formula
 
 import (
-	"net/http"
+	"sort"
 	"sync"
-	"time"
 )
 
+// FormulaList is the dependency graph (DAG) of a formula.
+// Every formula appears once, keyed by its full name, with an edge for every dependency relation.
 type FormulaList struct {
-	count int
-
 	root *FormulaNode
 
-	// key string: formula name
-	uniques map[string]bool
+	// key string: formula full name
+	nodes map[string]*FormulaNode
 
 	// lock is used to make the list thread-safe
 	lock *sync.RWMutex
 
-	httpClient *http.Client
-
 	threads int
 
-	iteratorChannelCount int
+	// errors of the formulae that couldn't be resolved
+	errors []*FormulaError
+
+	// key string: formula name
+	// the formulae left out of the list because they are already installed
+	installed map[string]*Formula
 }
 
 func newFormulaList(mainFormula *Formula, threads int) *FormulaList {
 	list := &FormulaList{
-		uniques: make(map[string]bool),
-		lock:    &sync.RWMutex{},
-		root:    newFormulaNode(mainFormula),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		threads: threads,
+		nodes:     make(map[string]*FormulaNode),
+		installed: make(map[string]*Formula),
+		lock:      &sync.RWMutex{},
+		root:      newFormulaNode(mainFormula),
+		threads:   threads,
 	}
 
 	if threads == 0 {
 		list.threads = 5
 	}
 
-	list.count++
+	list.nodes[getKey(mainFormula)] = list.root
 
 	return list
 }
+
+// NewFormulaList returns a list of the given formula without its dependencies, they are added with AddDependency.
+// example: the installed formulae to uninstall, from the receipts in the Cellar. See GetFormulaList to resolve them.
+func NewFormulaList(mainFormula *Formula, threads int) *FormulaList {
+	return newFormulaList(mainFormula, threads)
+}
+
+// AddDependency records that parent depends on child at runtime, they are added to the list if they are new.
+func (list *FormulaList) AddDependency(parent *Formula, child *Formula) {
+	p, _ := list.getOrAddNode(parent)
+	c, _ := list.getOrAddNode(child)
+
+	list.addEdge(p, c, KindRuntime)
+}
+
+// Root returns the node of the main formula.
+func (list *FormulaList) Root() *FormulaNode {
+	return list.root
+}
+
+// getOrAddNode returns the node of the given formula, it's added to the list if it's new.
+// The second value is true if the node was added.
+func (list *FormulaList) getOrAddNode(f *Formula) (*FormulaNode, bool) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if node, ok := list.nodes[getKey(f)]; ok {
+		return node, false
+	}
+
+	node := newFormulaNode(f)
+	list.nodes[getKey(f)] = node
+
+	return node, true
+}
+
+// addEdge records that parent depends on child, with the given kind of dependency.
+func (list *FormulaList) addEdge(parent *FormulaNode, child *FormulaNode, kind DependencyKind) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if parent.hasDependency(child) {
+		return
+	}
+
+	parent.dependencies = append(parent.dependencies, child)
+	parent.kinds[child] = kind
+	child.dependents = append(child.dependents, parent)
+}
+
+// markExpanded marks the node as expanded at the given level, it returns false if it already was at the same or a shallower level.
+// it makes sure the dependencies of a formula are only resolved once per level,
+// and again when it's reached at a shallower level, so that the result of a dependency level doesn't depend on
+// which of the goroutines reached the formula first.
+func (list *FormulaList) markExpanded(node *FormulaNode, level int) bool {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if node.expandedLevel > 0 && node.expandedLevel <= level {
+		return false
+	}
+
+	node.expandedLevel = level
+
+	return true
+}
+
+// Formulae returns every formula in the list, the main formula included.
+// The formulae are sorted topologically, every formula comes after all of its dependencies.
+func (list *FormulaList) Formulae() []*Formula {
+	nodes := list.sortedNodes()
+	formulae := make([]*Formula, len(nodes))
+
+	for i, node := range nodes {
+		formulae[i] = node.formula
+	}
+
+	return formulae
+}
+
+// sortedNodes returns the nodes sorted topologically (dependencies first),
+// the nodes without an order between them are sorted by name.
+func (list *FormulaList) sortedNodes() []*FormulaNode {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	var pending = make(map[*FormulaNode]int, len(list.nodes))
+	var ready []*FormulaNode
+
+	for _, node := range list.nodes {
+		pending[node] = len(node.dependencies)
+
+		if len(node.dependencies) == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	var sorted = make([]*FormulaNode, 0, len(list.nodes))
+
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			return getKey(ready[i].formula) < getKey(ready[j].formula)
+		})
+
+		node := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, node)
+
+		for _, dependent := range node.dependents {
+			pending[dependent]--
+
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	return sorted
+}
+
+// findCycle returns the formulae of a dependency cycle, or nil if the list has none.
+// example: [a b c a] means a depends on b, b on c and c on a.
+func (list *FormulaList) findCycle() []string {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var state = make(map[*FormulaNode]int, len(list.nodes))
+	var path []*FormulaNode
+	var cycle []string
+	var visit func(node *FormulaNode) bool
+
+	visit = func(node *FormulaNode) bool {
+		state[node] = visiting
+		path = append(path, node)
+
+		for _, dep := range node.dependencies {
+			if state[dep] == visiting {
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == dep {
+						for _, n := range path[i:] {
+							cycle = append(cycle, getKey(n.formula))
+						}
+						cycle = append(cycle, getKey(dep.formula))
+						return true
+					}
+				}
+			}
+
+			if state[dep] == unvisited && visit(dep) {
+				return true
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[node] = visited
+
+		return false
+	}
+
+	// from the main formula first, so that a cycle through it starts with it.
+	if visit(list.root) {
+		return cycle
+	}
+
+	for _, node := range list.nodes {
+		if state[node] == unvisited && visit(node) {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// getKey returns the key of the formula in the list, its full name.
+func getKey(f *Formula) string {
+	if len(f.FullName) > 0 {
+		return f.FullName
+	}
+	return f.Name
+}
+
+// addError records the error of a formula that couldn't be resolved.
+func (list *FormulaList) addError(name string, err error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	list.errors = append(list.errors, &FormulaError{Name: name, Err: err})
+}
+
+// getError returns a *ResolveError of all the recorded errors, or nil if there is none.
+func (list *FormulaList) getError() error {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	if len(list.errors) == 0 {
+		return nil
+	}
+
+	return &ResolveError{Errors: list.errors}
+}
+
+// addInstalled records a formula that was left out of the list because it's already installed.
+func (list *FormulaList) addInstalled(f *Formula) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	list.installed[f.Name] = f
+}
+
+// Installed returns the formulae that were left out of the list because they are already installed.
+func (list *FormulaList) Installed() []*Formula {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	var formulae = make([]*Formula, 0, len(list.installed))
+
+	for _, f := range list.installed {
+		formulae = append(formulae, f)
+	}
+
+	sort.Slice(formulae, func(i, j int) bool {
+		return formulae[i].Name < formulae[j].Name
+	})
+
+	return formulae
+}
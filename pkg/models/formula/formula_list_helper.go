@@ -1,13 +1,18 @@
 package formula
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
 	"sync"
-	"time"
 
+	"github.com/hamza72x/brewc/pkg/cellar"
 	"github.com/hamza72x/brewc/pkg/constant"
+	"github.com/hamza72x/brewc/pkg/retry"
 	"github.com/hamza72x/brewc/pkg/util"
 	col "github.com/hamza72x/go-color"
 )
@@ -23,12 +28,53 @@ type GetFormulaListOpts struct {
 	// default is 5
 	Threads int
 
-	// only unique formulas
-	// default is false
-	Unique bool
+	// Platform is the bottle tag the dependencies are resolved for, see Formula.GetDependencies
+	// default is empty, the default dependencies of the formulae
+	Platform string
+
+	// IncludeBuild follows the build dependencies too, example: for --build-from-source installs
+	IncludeBuild bool
+
+	// IncludeTest follows the test dependencies too, example: for `brew test` in CI
+	IncludeTest bool
+
+	// IncludeOptional follows the optional dependencies too
+	IncludeOptional bool
+
+	// SkipRecommended doesn't follow the recommended dependencies, brew installs them by default
+	SkipRecommended bool
+
+	// Quiet doesn't print the progress, example: for the output of the deps command
+	Quiet bool
+}
+
+// printf prints the progress, unless opts.Quiet is set.
+func (opts *GetFormulaListOpts) printf(format string, a ...any) {
+	if !opts.Quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// includes returns true if the dependencies of the given kind are followed.
+func (opts *GetFormulaListOpts) includes(kind DependencyKind) bool {
+	switch kind {
+	case KindBuild:
+		return opts.IncludeBuild
+	case KindTest:
+		return opts.IncludeTest
+	case KindOptional:
+		return opts.IncludeOptional
+	case KindRecommended:
+		return !opts.SkipRecommended
+	default:
+		return true
+	}
 }
 
 // GetFormulaList returns a list of all the formulae
+// If some of the dependencies couldn't be resolved, the partial list is returned
+// along with a *ResolveError listing every formula that failed and why.
+// A *CycleError is returned if the dependencies form a cycle.
 func GetFormulaList(name string, opts *GetFormulaListOpts) (*FormulaList, error) {
 
 	if opts.DependencyLevel == 0 {
@@ -41,226 +87,196 @@ func GetFormulaList(name string, opts *GetFormulaListOpts) (*FormulaList, error)
 		return nil, err
 	}
 
-	fmt.Printf("%s Getting dependencies for %s\n", constant.GreenArrow, col.Info(name))
-	fmt.Printf("%s Dependency level: %d\n\n", constant.GreenArrow, opts.DependencyLevel)
+	opts.printf("%s Getting dependencies for %s\n", constant.GreenArrow, col.Info(name))
+	opts.printf("%s Dependency level: %d\n\n", constant.GreenArrow, opts.DependencyLevel)
 
 	list := newFormulaList(mainFormula, opts.Threads)
 
-	fmt.Printf("Formula: %s, deps: ", col.Info(name))
-	err = list.setNodesRecursive(name, list.root, opts, 1)
+	// if the formula is already installed, then we don't need to install it again.
+	// that's also means that all of its dependencies are already installed too.
+	if !mainFormula.IsInstalled() || opts.IncludeInstalled {
+		opts.printf("Formula: %s, deps: ", col.Info(name))
+		list.setNodesRecursive(list.root, opts, 1)
+	}
 
-	fmt.Printf("\n\n%s Discovered %d dependencies\n", constant.GreenArrow, list.Count())
+	opts.printf("\n\n%s Discovered %d dependencies\n", constant.GreenArrow, list.Count()-1)
 
-	if err != nil {
-		return nil, err
+	if cycle := list.findCycle(); cycle != nil {
+		return nil, &CycleError{Cycle: cycle}
 	}
 
-	return list, nil
+	return list, list.getError()
 }
 
-// setNodes sets the nodes of the formula list.
-func (list *FormulaList) setNodesRecursive(name string, parentNode *FormulaNode, opts *GetFormulaListOpts, level int) error {
+// setNodesRecursive adds the dependencies of the given node to the list,
+// and resolves their own dependencies until the dependency level is reached.
+// The errors are recorded in the list, see getError.
+func (list *FormulaList) setNodesRecursive(parentNode *FormulaNode, opts *GetFormulaListOpts, level int) {
 
 	var wg sync.WaitGroup
 	var conn = make(chan int, list.threads)
 
-	var mainFormula, err = GetFormulaJSON(name)
+	// with all of the dependencies the level doesn't matter, a node is only expanded once.
+	expandLevel := level
 
-	if err != nil {
-		return err
+	if opts.DependencyLevel == -1 {
+		expandLevel = 1
 	}
 
-	// if the formula is already installed, then we don't need to install it again.
-	// that's also means that all of its dependencies are already installed too.
-	if mainFormula.IsInstalled() && !opts.IncludeInstalled {
-		return nil
+	if !list.markExpanded(parentNode, expandLevel) {
+		return
 	}
 
-	// if it's the main formula, we don't need to add it as a child of itself.
-	if parentNode != list.root {
-		if list.AddChild(parentNode, newFormulaNode(mainFormula), opts.Unique) {
-			fmt.Printf("\nFormula: %s, deps: ", col.Info(name))
+	for _, dep := range parentNode.formula.GetAllDependencies(opts.Platform) {
+		if !opts.includes(dep.Kind) {
+			continue
 		}
-	}
 
-	for _, dep := range mainFormula.Dependencies {
 		wg.Add(1)
 
-		go func(dep string) {
+		go func(dep Dependency) {
 			conn <- 1
 
 			defer wg.Done()
 			defer func() { <-conn }()
 
-			f, err := GetFormulaJSON(dep)
+			f, err := GetFormulaJSON(dep.Name)
 
 			if err != nil {
-				fmt.Printf("%s Error getting formula %s: %v", constant.RedArrow, dep, err)
+				list.addError(dep.Name, err)
 				return
 			}
 
+			// if the formula is already installed, then we don't need to install it again.
+			// that's also means that all of its dependencies are already installed too.
 			if f.IsInstalled() && !opts.IncludeInstalled {
+				list.addInstalled(f)
 				return
 			}
 
-			newNode := newFormulaNode(f)
+			node, added := list.getOrAddNode(f)
+			list.addEdge(parentNode, node, dep.Kind)
 
-			if list.AddChild(parentNode, newNode, opts.Unique) {
-				fmt.Printf("%s ", col.Info(dep))
+			if added && f.GetInstallState() == cellar.Outdated {
+				opts.printf("%s(outdated) ", col.Info(dep.Name))
+			} else if added {
+				opts.printf("%s ", col.Info(dep.Name))
 			}
 
 			if level >= opts.DependencyLevel && opts.DependencyLevel != -1 {
 				return
 			}
 
-			if err := list.setNodesRecursive(dep, newNode, opts, level+1); err != nil {
-				fmt.Printf("%s Error getting nested formula %s: %v", constant.RedArrow, dep, err)
-			}
+			list.setNodesRecursive(node, opts, level+1)
 
 		}(dep)
 	}
 
 	wg.Wait()
-
-	return nil
 }
 
-func (list *FormulaList) hasFormula(formula *Formula) bool {
-	list.lock.RLock()
-	defer list.lock.RUnlock()
-
-	if val, ok := list.uniques[formula.Name]; ok && val {
-		return true
-	}
+// retryPolicy retries the failed formula requests, see SetRetryPolicy
+var retryPolicy = retry.DefaultPolicy()
 
-	return false
+// SetRetryPolicy sets the retry policy of the formula requests.
+func SetRetryPolicy(policy *retry.Policy) {
+	retryPolicy = policy
 }
 
-func (list *FormulaList) AddChild(parent *FormulaNode, child *FormulaNode, keepUniqueInList bool) bool {
-	if keepUniqueInList && list.hasFormula(child.formula) {
-		return false
-	}
-
-	list.lock.Lock()
-	defer list.lock.Unlock()
+// offline makes GetFormulaJSON read only from the local caches, see SetOffline
+var offline bool
 
-	list.uniques[child.formula.Name] = true
-	parent.children = append(parent.children, child)
-	list.count++
+// ErrNotCached is returned in offline mode for a formula missing from the local caches.
+var ErrNotCached = errors.New("not in the local formula cache")
 
-	return true
+// SetOffline makes GetFormulaJSON read the formulae only from the index (see UseIndex)
+// and from the files saved by previous runs (see GetFormulaCachePath), without any network request.
+func SetOffline(value bool) {
+	offline = value
 }
 
-// IterateChildFirst iterates over the list in a child-first manner.
-// This means that the callback will be called only if there is no child of the given node.
-// Otherwise, the callback will be called after all of the children have been processed.
-func (list *FormulaList) IterateChildFirst(threads int, fn func(*Formula)) {
-	list.iteratorChannelCount = 0
-	list.childFirstIterator(list.root, fn)
-}
-
-func (list *FormulaList) childFirstIterator(node *FormulaNode, fn func(*Formula)) {
-
-	// If there is no child, then we can call the callback
-	if len(node.children) == 0 {
-		fn(node.formula)
-		return
-	}
-
-	var threads = 5
-
-	if list.iteratorChannelCount >= list.threads {
-		threads = 1
-	}
-
-	list.iteratorChannelCount += threads
-
-	var wg sync.WaitGroup
-	var ch = make(chan int, threads)
-
-	fmt.Printf("🛠  Resolving dependencies for %s 🛠\n", node.formula.Name)
-	list.printActiveThreads()
-
-	// If there is a child, then we need to wait for all of the children to finish
-	for _, child := range node.children {
-		wg.Add(1)
-		go func(child *FormulaNode) {
-			ch <- 1
-			list.childFirstIterator(child, fn)
-			wg.Done()
-			<-ch
-		}(child)
-	}
+// GetFormulaJSON returns the formula of the given name.
+// each formula is only downloaded once per run, see formulaCache.
+func GetFormulaJSON(name string) (*Formula, error) {
+	return cache.get(name, func(name string) (*Formula, error) {
+		if index != nil {
+			if f, ok := index.Get(name); ok {
+				return f, nil
+			}
+		}
 
-	wg.Wait()
-	list.iteratorChannelCount -= threads
+		if offline {
+			return readCachedFormula(name)
+		}
 
-	// After all the children are done, we can call the callback
-	fmt.Printf("🎉 Completed all dependencies of %s 🎉\n", node.formula.Name)
-	fn(node.formula)
+		return fetchFormulaJSON(name)
+	})
 }
 
-// IterateParentFirst iterates over the list in a parent-first manner.
-func (list *FormulaList) IterateParentFirst(threads int, fn func(*Formula)) {
-	list.iteratorChannelCount = 0
-	list.parentFirstIterator(list.root, fn)
+// GetFormulaCachePath returns the path where the json of a formula is saved, for the offline mode.
+// example: $HOMEBREW_CACHE/brewc/formula/ffmpeg.json
+func GetFormulaCachePath(name string) string {
+	return filepath.Join(constant.Get().DirBrewc, "formula", name+".json")
 }
 
-func (list *FormulaList) parentFirstIterator(node *FormulaNode, fn func(*Formula)) {
-	fn(node.formula)
+// readCachedFormula reads the formula saved by a previous run.
+func readCachedFormula(name string) (*Formula, error) {
+	var f Formula
 
-	var threads = 5
+	path := GetFormulaCachePath(name)
 
-	if list.iteratorChannelCount >= list.threads {
-		threads = 1
+	if !util.DoesFileExist(path) {
+		return nil, fmt.Errorf("%w: %s", ErrNotCached, path)
 	}
 
-	list.iteratorChannelCount += threads
-
-	var wg sync.WaitGroup
-	var ch = make(chan int, threads)
-
-	list.printActiveThreads()
-
-	for _, child := range node.children {
-		wg.Add(1)
-		go func(child *FormulaNode) {
-			ch <- 1
-			list.parentFirstIterator(child, fn)
-			wg.Done()
-			<-ch
-		}(child)
+	if err := readJSON(path, &f); err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
-	list.iteratorChannelCount -= threads
-}
-
-func (list *FormulaList) printActiveThreads() {
-	fmt.Printf("🧶 Active Threads: %d 🧶\n", list.iteratorChannelCount)
+	return &f, nil
 }
 
 // DECIDE: should we use the github API to get the list of formulas?
 // Or check local installation folder
-func GetFormulaJSON(name string) (*Formula, error) {
+func fetchFormulaJSON(name string) (*Formula, error) {
 	var f Formula
+	var data []byte
 
 	var url = util.GetFormulaURL(name)
 
-	resp, err := doGET(url)
+	err := retryPolicy.Run(func() error {
+		resp, err := doGET(url)
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
 
-	defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return retry.NewStatusError(resp)
+		}
 
-	err = json.NewDecoder(resp.Body).Decode(&f)
+		data, err = io.ReadAll(resp.Body)
+
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(data, &f)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	// saved for the offline mode, a failure only means it won't be available offline.
+	path := GetFormulaCachePath(name)
+
+	if util.CreateDirIfNotExists(filepath.Dir(path)) == nil {
+		util.WriteFile(path, bytes.NewReader(data))
+	}
+
 	return &f, nil
 }
 
@@ -273,7 +289,7 @@ func doGET(url string) (*http.Response, error) {
 	}
 
 	client := &http.Client{
-		Timeout: time.Second * 5,
+		Timeout: retryPolicy.Timeout,
 	}
 
 	resp, err := client.Do(req)
@@ -0,0 +1,225 @@
+package formula
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hamza72x/brewc/pkg/cellar"
+)
+
+// WriteOpts are the options of the outputs of a FormulaList, see WriteTree, WriteFlat, WriteDOT and WriteJSON.
+// the kind of every dependency other than runtime is always written, example: cmake (build)
+type WriteOpts struct {
+	// Annotate adds the install state of every formula: installed, outdated or missing
+	Annotate bool
+}
+
+// ListJSON is the json output of a FormulaList, see WriteJSON.
+type ListJSON struct {
+	Name     string        `json:"name"`
+	Formulae []FormulaJSON `json:"formulae"`
+}
+
+// FormulaJSON is a formula in the json output of a FormulaList.
+type FormulaJSON struct {
+	Name         string           `json:"name"`
+	FullName     string           `json:"full_name"`
+	Version      string           `json:"version"`
+	State        string           `json:"state,omitempty"`
+	Dependencies []DependencyJSON `json:"dependencies"`
+}
+
+// DependencyJSON is a dependency of a formula in the json output of a FormulaList.
+type DependencyJSON struct {
+	Name string         `json:"name"`
+	Kind DependencyKind `json:"kind"`
+}
+
+// WriteTree writes the dependencies as an indented tree, the way `brew deps --tree` does.
+// a formula needed by more than one formula is written under each of them.
+func (list *FormulaList) WriteTree(w io.Writer, opts *WriteOpts) error {
+	var write func(node *FormulaNode, kind DependencyKind, prefix string, last bool, depth int) error
+
+	write = func(node *FormulaNode, kind DependencyKind, prefix string, last bool, depth int) error {
+		branch, indent := "├── ", "│   "
+
+		if last {
+			branch, indent = "└── ", "    "
+		}
+
+		// the root has no branch
+		if depth == 0 {
+			branch, indent = "", ""
+		}
+
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, branch, getLabel(node.formula, kind, opts)); err != nil {
+			return err
+		}
+
+		deps := getSortedDependencies(node)
+
+		for i, dep := range deps {
+			if err := write(dep, node.kinds[dep], prefix+indent, i == len(deps)-1, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	return write(list.root, KindRuntime, "", true, 0)
+}
+
+// WriteFlat writes one formula per line, sorted topologically: every formula after all of its dependencies.
+func (list *FormulaList) WriteFlat(w io.Writer, opts *WriteOpts) error {
+	for _, node := range list.sortedNodes() {
+		if _, err := fmt.Fprintln(w, getLabel(node.formula, list.getKind(node), opts)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteDOT writes the dependency graph in the Graphviz DOT language.
+// example: brewc deps --format dot ffmpeg | dot -Tsvg > ffmpeg.svg
+func (list *FormulaList) WriteDOT(w io.Writer, opts *WriteOpts) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %q {\n", list.root.formula.Name)
+
+	for _, node := range list.sortedNodes() {
+		attrs := ""
+
+		if opts.Annotate {
+			attrs = fmt.Sprintf(" [label=%q, style=filled, fillcolor=%q]", node.formula.Name+"\n"+getState(node.formula), getStateColor(node.formula))
+		}
+
+		fmt.Fprintf(&b, "  %q%s;\n", node.formula.Name, attrs)
+	}
+
+	for _, node := range list.sortedNodes() {
+		for _, dep := range getSortedDependencies(node) {
+			attrs := ""
+
+			if kind := node.kinds[dep]; kind != KindRuntime {
+				attrs = fmt.Sprintf(" [label=%q, style=dashed]", kind)
+			}
+
+			fmt.Fprintf(&b, "  %q -> %q%s;\n", node.formula.Name, dep.formula.Name, attrs)
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteJSON writes the formulae as json, sorted topologically, see ListJSON.
+func (list *FormulaList) WriteJSON(w io.Writer, opts *WriteOpts) error {
+	out := ListJSON{Name: list.root.formula.Name}
+
+	for _, node := range list.sortedNodes() {
+		f := FormulaJSON{
+			Name:         node.formula.Name,
+			FullName:     node.formula.FullName,
+			Version:      node.formula.PkgVersion(),
+			Dependencies: []DependencyJSON{},
+		}
+
+		if opts.Annotate {
+			f.State = getState(node.formula)
+		}
+
+		for _, dep := range getSortedDependencies(node) {
+			f.Dependencies = append(f.Dependencies, DependencyJSON{Name: dep.formula.Name, Kind: node.kinds[dep]})
+		}
+
+		out.Formulae = append(out.Formulae, f)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(out)
+}
+
+// getKind returns the kind of the node for the flat output,
+// runtime if any of its dependents needs it at runtime.
+func (list *FormulaList) getKind(node *FormulaNode) DependencyKind {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	if len(node.dependents) == 0 {
+		return KindRuntime
+	}
+
+	kind := node.dependents[0].kinds[node]
+
+	for _, dependent := range node.dependents {
+		if dependent.kinds[node] == KindRuntime {
+			return KindRuntime
+		}
+	}
+
+	return kind
+}
+
+// getSortedDependencies returns the dependencies of the node sorted by name.
+func getSortedDependencies(node *FormulaNode) []*FormulaNode {
+	deps := append([]*FormulaNode{}, node.dependencies...)
+
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].formula.Name < deps[j].formula.Name
+	})
+
+	return deps
+}
+
+// getLabel returns the name of the formula with its annotations.
+// example: zlib, zlib [installed], cmake (build) [missing]
+func getLabel(f *Formula, kind DependencyKind, opts *WriteOpts) string {
+	label := f.Name
+
+	if kind != KindRuntime {
+		label += fmt.Sprintf(" (%s)", kind)
+	}
+
+	if opts.Annotate {
+		label += fmt.Sprintf(" [%s]", getState(f))
+	}
+
+	return label
+}
+
+// getState returns the install state of the formula in the outputs: installed, outdated or missing
+func getState(f *Formula) string {
+	switch f.GetInstallState() {
+	case cellar.Current:
+		return "installed"
+	case cellar.Outdated:
+		return "outdated"
+	default:
+		return "missing"
+	}
+}
+
+// getStateColor returns the fill color of the formula in the DOT output.
+func getStateColor(f *Formula) string {
+	switch f.GetInstallState() {
+	case cellar.Current:
+		return "palegreen"
+	case cellar.Outdated:
+		return "khaki"
+	default:
+		return "lightpink"
+	}
+}
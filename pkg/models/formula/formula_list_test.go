@@ -0,0 +1,162 @@
+package formula
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hamza72x/brewc/pkg/constant"
+)
+
+// useTestCache points brew's directories to a temporary directory, with an empty Cellar.
+func useTestCache(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	t.Setenv("HOMEBREW_PREFIX", filepath.Join(dir, "prefix"))
+	t.Setenv("HOMEBREW_CELLAR", filepath.Join(dir, "prefix", "Cellar"))
+	t.Setenv("HOMEBREW_CACHE", filepath.Join(dir, "cache"))
+
+	if err := constant.Initialize("arm64", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useTestIndex serves the given formulae (name => dependencies) from the index, with an empty Cellar.
+func useTestIndex(t *testing.T, deps map[string][]string) {
+	t.Helper()
+
+	useTestCache(t)
+
+	idx := &FormulaIndex{formulae: make(map[string]*Formula)}
+
+	for name, d := range deps {
+		idx.formulae[name] = &Formula{Name: name, Versions: Versions{Stable: "1.0"}, Dependencies: d}
+	}
+
+	UseIndex(idx)
+
+	t.Cleanup(func() {
+		UseIndex(nil)
+		cache = newFormulaCache()
+	})
+}
+
+// getNames returns the names of the formulae in the list, sorted.
+func getNames(list *FormulaList) []string {
+	var names []string
+
+	for _, f := range list.Formulae() {
+		names = append(names, f.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestGetFormulaListDepth(t *testing.T) {
+	// a reaches b directly, and through c at a deeper level
+	useTestIndex(t, map[string][]string{
+		"a": {"c", "b"},
+		"c": {"b"},
+		"b": {"d"},
+		"d": {"e"},
+		"e": {},
+	})
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{1, []string{"a", "b", "c"}},
+		{2, []string{"a", "b", "c", "d"}},
+		{3, []string{"a", "b", "c", "d", "e"}},
+		{-1, []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for _, tt := range tests {
+		// the order the goroutines reach b in varies between the runs
+		for i := 0; i < 50; i++ {
+			list, err := GetFormulaList("a", &GetFormulaListOpts{DependencyLevel: tt.depth, IncludeInstalled: true, Threads: 4, Quiet: true})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := getNames(list); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("depth %d: got %v, want %v", tt.depth, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestGetFormulaListDepthOrder(t *testing.T) {
+	useTestIndex(t, map[string][]string{
+		"a": {"c", "b"},
+		"c": {"b"},
+		"b": {"d"},
+		"d": {"e"},
+		"e": {},
+	})
+
+	opts := &GetFormulaListOpts{DependencyLevel: 3, IncludeInstalled: true, Threads: 4, Quiet: true}
+
+	a, _ := GetFormulaJSON("a")
+	c, _ := GetFormulaJSON("c")
+
+	list := newFormulaList(a, 4)
+
+	// the path through c reaches b first, at level 2.
+	node, _ := list.getOrAddNode(c)
+	list.addEdge(list.root, node, KindRuntime)
+	list.setNodesRecursive(node, opts, 2)
+
+	if got, want := getNames(list), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("through c: got %v, want %v", got, want)
+	}
+
+	// a reaches b at level 1, so e (level 3) is in the list too.
+	list.setNodesRecursive(list.root, opts, 1)
+
+	if got, want := getNames(list), []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetFormulaListCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{"through the main formula", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}, []string{"a", "b", "c", "a"}},
+		{"between the dependencies", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b", "d"}, "d": {}}, []string{"b", "c", "b"}},
+		{"itself", map[string][]string{"a": {"b"}, "b": {"b"}}, []string{"b", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestIndex(t, tt.deps)
+
+			list, err := GetFormulaList("a", &GetFormulaListOpts{DependencyLevel: -1, IncludeInstalled: true, Quiet: true})
+
+			var cycleErr *CycleError
+
+			if !errors.As(err, &cycleErr) {
+				t.Fatalf("expected a *CycleError, got %v", err)
+			}
+
+			if list != nil {
+				t.Fatal("expected no list")
+			}
+
+			if !reflect.DeepEqual(cycleErr.Cycle, tt.want) {
+				t.Fatalf("cycle is %v, want %v", cycleErr.Cycle, tt.want)
+			}
+		})
+	}
+}
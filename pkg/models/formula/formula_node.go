@@ -1,16 +1,62 @@
 package formula
 
+// FormulaNode is a formula in the dependency graph of a FormulaList.
 type FormulaNode struct {
-	formula  *Formula
-	children []*FormulaNode
+	formula *Formula
+
+	// dependencies are the nodes this formula depends on
+	dependencies []*FormulaNode
+
+	// dependents are the nodes depending on this formula
+	dependents []*FormulaNode
+
+	// kinds are the kinds of the dependencies, example: runtime, build
+	kinds map[*FormulaNode]DependencyKind
+
+	// expandedLevel is the shallowest level the dependencies of the formula were resolved at, 0 until they are.
+	expandedLevel int
 }
 
 func newFormulaNode(formula *Formula) *FormulaNode {
 	return &FormulaNode{
 		formula: formula,
+		kinds:   make(map[*FormulaNode]DependencyKind),
+	}
+}
+
+// Formula returns the formula of the node.
+func (node *FormulaNode) Formula() *Formula {
+	return node.formula
+}
+
+// Dependencies returns the nodes this formula depends on.
+func (node *FormulaNode) Dependencies() []*FormulaNode {
+	return node.dependencies
+}
+
+// DependencyKind returns the kind of the given dependency of the node, example: runtime, build
+func (node *FormulaNode) DependencyKind(dep *FormulaNode) DependencyKind {
+	return node.kinds[dep]
+}
+
+// Dependents returns the nodes depending on this formula.
+func (node *FormulaNode) Dependents() []*FormulaNode {
+	return node.dependents
+}
+
+// hasDependency returns true if there is already an edge to the given node.
+func (node *FormulaNode) hasDependency(dep *FormulaNode) bool {
+	for _, d := range node.dependencies {
+		if d == dep {
+			return true
+		}
 	}
+	return false
 }
 
 func (list *FormulaList) Count() int {
-	return list.count
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	return len(list.nodes)
 }
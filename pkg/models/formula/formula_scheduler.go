@@ -0,0 +1,164 @@
+package formula
+
+import (
+	"sort"
+)
+
+// ScheduleResult is the outcome of a scheduled iteration over the list.
+type ScheduleResult struct {
+	// key string: formula name, value: the error of its callback
+	Failed map[string]error
+
+	// key string: formula name, value: the name of the failed formula it was waiting for
+	Skipped map[string]string
+}
+
+// scheduled is the result of a callback, sent from a worker to the scheduler.
+type scheduled struct {
+	node *FormulaNode
+	err  error
+}
+
+// IterateChildFirst iterates over the list in a child-first manner.
+// This means that the callback of a formula is called only after the callbacks of all of its dependencies have returned.
+// Exactly `threads` workers run the callbacks.
+func (list *FormulaList) IterateChildFirst(threads int, fn func(*Formula)) {
+	list.ScheduleChildFirst(threads, func(f *Formula) error {
+		fn(f)
+		return nil
+	})
+}
+
+// IterateParentFirst iterates over the list in a parent-first manner.
+// This means that the callback of a formula is called only after the callbacks of all of its dependents have returned.
+// Exactly `threads` workers run the callbacks.
+func (list *FormulaList) IterateParentFirst(threads int, fn func(*Formula)) {
+	list.ScheduleParentFirst(threads, func(f *Formula) error {
+		fn(f)
+		return nil
+	})
+}
+
+// ScheduleChildFirst is IterateChildFirst with failure propagation:
+// when a callback returns an error, the callbacks of all of the formulae depending on it are skipped.
+func (list *FormulaList) ScheduleChildFirst(threads int, fn func(*Formula) error) *ScheduleResult {
+	return list.schedule(threads, fn, func(node *FormulaNode) []*FormulaNode {
+		return node.dependencies
+	}, func(node *FormulaNode) []*FormulaNode {
+		return node.dependents
+	})
+}
+
+// ScheduleParentFirst is IterateParentFirst with failure propagation:
+// when a callback returns an error, the callbacks of all of its dependencies are skipped.
+func (list *FormulaList) ScheduleParentFirst(threads int, fn func(*Formula) error) *ScheduleResult {
+	return list.schedule(threads, fn, func(node *FormulaNode) []*FormulaNode {
+		return node.dependents
+	}, func(node *FormulaNode) []*FormulaNode {
+		return node.dependencies
+	})
+}
+
+// schedule runs fn for every node on a pool of `threads` workers.
+// A node is ready once the callbacks of all of the nodes returned by `before` have succeeded,
+// `after` returns the nodes waiting for it, which are skipped if its callback fails.
+func (list *FormulaList) schedule(threads int, fn func(*Formula) error, before, after func(*FormulaNode) []*FormulaNode) *ScheduleResult {
+	if threads <= 0 {
+		threads = list.threads
+	}
+
+	result := &ScheduleResult{
+		Failed:  make(map[string]error),
+		Skipped: make(map[string]string),
+	}
+
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+
+	total := len(list.nodes)
+
+	// in-degree of every node, the number of callbacks it's still waiting for
+	var pending = make(map[*FormulaNode]int, total)
+	var initial []*FormulaNode
+
+	for _, node := range list.nodes {
+		pending[node] = len(before(node))
+
+		if pending[node] == 0 {
+			initial = append(initial, node)
+		}
+	}
+
+	sort.Slice(initial, func(i, j int) bool {
+		return getKey(initial[i].formula) < getKey(initial[j].formula)
+	})
+
+	var ready = make(chan *FormulaNode, total)
+	var results = make(chan scheduled)
+
+	for i := 0; i < threads; i++ {
+		go func() {
+			for node := range ready {
+				results <- scheduled{node: node, err: fn(node.formula)}
+			}
+		}()
+	}
+
+	defer close(ready)
+
+	for _, node := range initial {
+		ready <- node
+	}
+
+	var skipped = make(map[*FormulaNode]bool)
+	var completed, running = 0, len(initial)
+
+	// skip marks the nodes waiting for the failed node as skipped, recursively.
+	var skip func(node *FormulaNode, failed string)
+
+	skip = func(node *FormulaNode, failed string) {
+		for _, next := range after(node) {
+			if skipped[next] {
+				continue
+			}
+
+			skipped[next] = true
+			result.Skipped[next.formula.Name] = failed
+			completed++
+
+			skip(next, failed)
+		}
+	}
+
+	for running > 0 {
+		r := <-results
+		running--
+		completed++
+
+		if r.err != nil {
+			result.Failed[r.node.formula.Name] = r.err
+			skip(r.node, r.node.formula.Name)
+			continue
+		}
+
+		for _, next := range after(r.node) {
+			pending[next]--
+
+			if pending[next] == 0 && !skipped[next] {
+				running++
+				ready <- next
+			}
+		}
+	}
+
+	// only possible with a dependency cycle, which GetFormulaList rejects.
+	if completed < total {
+		for node := range pending {
+			if pending[node] > 0 && !skipped[node] {
+				result.Skipped[node.formula.Name] = "dependency cycle"
+			}
+		}
+	}
+
+	return result
+}
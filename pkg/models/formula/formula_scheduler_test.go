@@ -0,0 +1,259 @@
+package formula
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestList returns a list of the main formula with the given edges, example: "app" => {"a", "b"}
+func newTestList(main string, threads int, edges map[string][]string) *FormulaList {
+	list := newFormulaList(&Formula{Name: main}, threads)
+
+	for parent, children := range edges {
+		p, _ := list.getOrAddNode(&Formula{Name: parent})
+
+		for _, child := range children {
+			c, _ := list.getOrAddNode(&Formula{Name: child})
+			list.addEdge(p, c, KindRuntime)
+		}
+	}
+
+	return list
+}
+
+func TestScheduleChildFirstOrder(t *testing.T) {
+	deps := map[string][]string{
+		"app": {"a", "b"},
+		"a":   {"lib", "zlib"},
+		"b":   {"lib"},
+		"lib": {"zlib"},
+	}
+
+	list := newTestList("app", 4, deps)
+
+	var lock sync.Mutex
+	var done = make(map[string]bool)
+
+	result := list.ScheduleChildFirst(4, func(f *Formula) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		for _, dep := range deps[f.Name] {
+			if !done[dep] {
+				t.Errorf("%s called before its dependency %s", f.Name, dep)
+			}
+		}
+
+		if done[f.Name] {
+			t.Errorf("%s called twice", f.Name)
+		}
+
+		done[f.Name] = true
+
+		return nil
+	})
+
+	if len(done) != 5 {
+		t.Fatalf("called for %d formulae, want 5", len(done))
+	}
+
+	if len(result.Failed) > 0 || len(result.Skipped) > 0 {
+		t.Fatalf("unexpected failures: %v, skipped: %v", result.Failed, result.Skipped)
+	}
+}
+
+func TestScheduleChildFirstFailure(t *testing.T) {
+	list := newTestList("app", 4, map[string][]string{
+		"app":  {"a", "b", "tool"},
+		"a":    {"lib", "zlib"},
+		"b":    {"lib"},
+		"tool": {"base"},
+		"base": {"zlib"},
+	})
+
+	errLib := errors.New("lib failed")
+	errBase := errors.New("base failed")
+
+	var lock sync.Mutex
+	var called []string
+
+	result := list.ScheduleChildFirst(4, func(f *Formula) error {
+		lock.Lock()
+		called = append(called, f.Name)
+		lock.Unlock()
+
+		switch f.Name {
+		case "lib":
+			return errLib
+		case "base":
+			return errBase
+		}
+
+		return nil
+	})
+
+	wantFailed := map[string]error{"lib": errLib, "base": errBase}
+
+	if !reflect.DeepEqual(result.Failed, wantFailed) {
+		t.Fatalf("failed: %v, want %v", result.Failed, wantFailed)
+	}
+
+	// app waits for both of them, it's attributed to the first one that failed.
+	if result.Skipped["app"] != "lib" && result.Skipped["app"] != "base" {
+		t.Fatalf("app skipped for %q", result.Skipped["app"])
+	}
+
+	delete(result.Skipped, "app")
+
+	// the skipped formulae are attributed to the failed one, not to the skipped one in between.
+	wantSkipped := map[string]string{"a": "lib", "b": "lib", "tool": "base"}
+
+	if !reflect.DeepEqual(result.Skipped, wantSkipped) {
+		t.Fatalf("skipped: %v, want %v", result.Skipped, wantSkipped)
+	}
+
+	// zlib doesn't depend on a failed formula
+	if len(called) != 3 {
+		t.Fatalf("called for %v, want lib, base and zlib", called)
+	}
+
+	for _, name := range called {
+		if name != "lib" && name != "base" && name != "zlib" {
+			t.Fatalf("called for the skipped formula %s", name)
+		}
+	}
+}
+
+func TestScheduleChildFirstWorkers(t *testing.T) {
+	edges := map[string][]string{"app": {}}
+
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		edges["app"] = append(edges["app"], name)
+	}
+
+	for _, threads := range []int{1, 3, 8} {
+		list := newTestList("app", 5, edges)
+
+		var lock sync.Mutex
+		var running, peak int
+		var full = make(chan struct{})
+		var once sync.Once
+
+		list.ScheduleChildFirst(threads, func(f *Formula) error {
+			lock.Lock()
+			running++
+
+			if running > peak {
+				peak = running
+			}
+
+			if running == threads {
+				once.Do(func() { close(full) })
+			}
+
+			lock.Unlock()
+
+			// wait until every worker is busy, so that a missing worker shows up.
+			select {
+			case <-full:
+			case <-time.After(2 * time.Second):
+			}
+
+			lock.Lock()
+			running--
+			lock.Unlock()
+
+			return nil
+		})
+
+		if peak != threads {
+			t.Fatalf("%d callbacks ran at once, want %d", peak, threads)
+		}
+	}
+}
+
+func TestScheduleParentFirst(t *testing.T) {
+	list := newTestList("app", 4, map[string][]string{
+		"app": {"a", "b"},
+		"a":   {"lib"},
+		"b":   {"lib", "zlib"},
+	})
+
+	errB := errors.New("b failed")
+
+	var lock sync.Mutex
+	var done = make(map[string]bool)
+
+	dependents := map[string][]string{
+		"a":    {"app"},
+		"b":    {"app"},
+		"lib":  {"a", "b"},
+		"zlib": {"b"},
+	}
+
+	result := list.ScheduleParentFirst(4, func(f *Formula) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		for _, dependent := range dependents[f.Name] {
+			if !done[dependent] {
+				t.Errorf("%s called before its dependent %s", f.Name, dependent)
+			}
+		}
+
+		done[f.Name] = true
+
+		if f.Name == "b" {
+			return errB
+		}
+
+		return nil
+	})
+
+	if !reflect.DeepEqual(result.Failed, map[string]error{"b": errB}) {
+		t.Fatalf("failed: %v", result.Failed)
+	}
+
+	// the dependencies of b wait for it, a doesn't
+	if want := map[string]string{"lib": "b", "zlib": "b"}; !reflect.DeepEqual(result.Skipped, want) {
+		t.Fatalf("skipped: %v, want %v", result.Skipped, want)
+	}
+
+	if want := map[string]bool{"app": true, "a": true, "b": true}; !reflect.DeepEqual(done, want) {
+		t.Fatalf("called for %v, want %v", done, want)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	edges := map[string][]string{
+		"app": {"a"},
+		"a":   {"lib"},
+	}
+
+	var lock sync.Mutex
+	var order []string
+
+	record := func(f *Formula) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		order = append(order, f.Name)
+	}
+
+	newTestList("app", 2, edges).IterateChildFirst(2, record)
+
+	if want := []string{"lib", "a", "app"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("child first: %v, want %v", order, want)
+	}
+
+	order = nil
+
+	newTestList("app", 2, edges).IterateParentFirst(2, record)
+
+	if want := []string{"app", "a", "lib"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("parent first: %v, want %v", order, want)
+	}
+}
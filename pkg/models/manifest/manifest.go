@@ -1,5 +1,10 @@
 package manifest
 
+import (
+	"fmt"
+	"strings"
+)
+
 // https://ghcr.io/v2/homebrew/core/libraw/manifests/0.21.1
 // Request Headers:
 //
@@ -47,3 +52,65 @@ type Platform struct {
 	OS           string `json:"os"`
 	OSVersion    string `json:"os.version"`
 }
+
+// MediaType is the `Accept` header needed to get the manifest from ghcr.io
+const MediaType = "application/vnd.oci.image.index.v1+json"
+
+// GetElement returns the manifest element of the given bottle tag.
+// example tag: arm64_ventura, x86_64_linux
+//
+// The element is matched by the tag at the end of its `org.opencontainers.image.ref.name`
+// annotation (example: 2.3.1.arm64_ventura), if none of them match it falls back
+// to the architecture and os of its platform.
+func (m *Manifest) GetElement(tag string) (*ManifestElement, error) {
+	for i, el := range m.Manifests {
+		ref := el.Annotations.OrgOpencontainersImageRefName
+		if strings.HasSuffix(ref, "."+tag) || strings.Contains(ref, "."+tag+".") {
+			return &m.Manifests[i], nil
+		}
+	}
+
+	arch, os := tagToPlatform(tag)
+
+	var found *ManifestElement
+
+	for i, el := range m.Manifests {
+		if el.Platform.Architecture != arch || el.Platform.OS != os {
+			continue
+		}
+
+		// more than one macOS version for the same architecture, the platform is ambiguous.
+		if found != nil {
+			return nil, fmt.Errorf("manifest: more than one element for platform %s/%s", os, arch)
+		}
+
+		found = &m.Manifests[i]
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("manifest: no element for bottle tag %s", tag)
+	}
+
+	return found, nil
+}
+
+// GetBottleDigest returns the sha256 of the bottle, from the `sh.brew.bottle.digest` annotation.
+func (el *ManifestElement) GetBottleDigest() string {
+	return el.Annotations.ShBrewBottleDigest
+}
+
+// tagToPlatform returns the OCI architecture and os of the given bottle tag.
+// example: arm64_ventura => arm64, darwin; x86_64_linux => amd64, linux; ventura => amd64, darwin
+func tagToPlatform(tag string) (string, string) {
+	arch := "amd64"
+
+	if strings.HasPrefix(tag, "arm64_") {
+		arch = "arm64"
+	}
+
+	if strings.HasSuffix(tag, "_linux") {
+		return arch, "linux"
+	}
+
+	return arch, "darwin"
+}
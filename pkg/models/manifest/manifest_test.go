@@ -0,0 +1,79 @@
+package manifest
+
+import (
+	"testing"
+)
+
+// newElement returns an element of the given ref name and platform.
+func newElement(ref string, arch string, os string) ManifestElement {
+	return ManifestElement{
+		Digest:      "sha256:" + ref + arch + os,
+		Platform:    Platform{Architecture: arch, OS: os},
+		Annotations: ManifestAnnotationsClass{OrgOpencontainersImageRefName: ref},
+	}
+}
+
+func TestGetElement(t *testing.T) {
+	refs := &Manifest{Manifests: []ManifestElement{
+		newElement("1.0.arm64_sonoma", "arm64", "darwin"),
+		newElement("1.0.sonoma", "amd64", "darwin"),
+		newElement("1.0.arm64_ventura.1", "arm64", "darwin"),
+		newElement("1.0.x86_64_linux", "amd64", "linux"),
+	}}
+
+	all := &Manifest{Manifests: []ManifestElement{
+		newElement("1.0.all", "", ""),
+	}}
+
+	// without ref names, only the platform tells them apart
+	platforms := &Manifest{Manifests: []ManifestElement{
+		newElement("", "arm64", "darwin"),
+		newElement("", "arm64", "linux"),
+		newElement("", "amd64", "linux"),
+	}}
+
+	ambiguous := &Manifest{Manifests: []ManifestElement{
+		newElement("", "arm64", "darwin"),
+		newElement("", "arm64", "darwin"),
+	}}
+
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		tag      string
+		want     *ManifestElement
+	}{
+		{"ref name", refs, "arm64_sonoma", &refs.Manifests[0]},
+		// not the arm64_sonoma one, its ref name only ends with _sonoma
+		{"intel ref name", refs, "sonoma", &refs.Manifests[1]},
+		{"rebuild", refs, "arm64_ventura", &refs.Manifests[2]},
+		{"linux ref name", refs, "x86_64_linux", &refs.Manifests[3]},
+		{"all", all, "all", &all.Manifests[0]},
+		{"platform", platforms, "arm64_sonoma", &platforms.Manifests[0]},
+		{"linux platform", platforms, "arm64_linux", &platforms.Manifests[1]},
+		{"intel linux platform", platforms, "x86_64_linux", &platforms.Manifests[2]},
+		{"ambiguous platform", ambiguous, "arm64_sonoma", nil},
+		{"no platform", platforms, "sonoma", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.manifest.GetElement(tt.tag)
+
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// PlatformDetector detects the platform brewc is running on.
+type PlatformDetector interface {
+	Detect() (*ArchAndCodeName, error)
+}
+
+// SystemPlatform detects the platform from the runtime,
+// and on macOS from the kern.osproductversion sysctl.
+type SystemPlatform struct{}
+
+// FakePlatform returns the given platform (or error), for tests and overrides.
+type FakePlatform struct {
+	Platform *ArchAndCodeName
+	Err      error
+}
+
+// Detect returns the platform brewc is running on.
+func (SystemPlatform) Detect() (*ArchAndCodeName, error) {
+	arch, err := getArch(runtime.GOARCH, isTranslated)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return &ArchAndCodeName{Architecture: arch, CodeName: Linux}, nil
+	case "darwin":
+		version, err := getMacOSVersion()
+
+		if err != nil {
+			return nil, err
+		}
+
+		codeName, ok := GetMacOSCodeName(version)
+
+		if !ok {
+			return nil, fmt.Errorf("unknown macOS version: %s", version)
+		}
+
+		return &ArchAndCodeName{Architecture: arch, CodeName: codeName}, nil
+	default:
+		return nil, fmt.Errorf("unsupported os: %s", runtime.GOOS)
+	}
+}
+
+// Detect returns the given platform.
+func (p *FakePlatform) Detect() (*ArchAndCodeName, error) {
+	return p.Platform, p.Err
+}
+
+// getArch returns the arch name of the given GOARCH, translated tells if the process runs with rosetta.
+// example: arm64, x86_64
+func getArch(goarch string, translated func() bool) (string, error) {
+	switch goarch {
+	case "arm64":
+		return Arm64, nil
+	case "amd64":
+		// an intel binary running on apple silicon (rosetta), brew is still arm64.
+		if translated() {
+			return Arm64, nil
+		}
+		return X86_64, nil
+	default:
+		return "", fmt.Errorf("unsupported arch: %s", goarch)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build darwin
+
+package models
+
+import "syscall"
+
+// getMacOSVersion returns the macOS version, example: 14.1
+func getMacOSVersion() (string, error) {
+	return syscall.Sysctl("kern.osproductversion")
+}
+
+// isTranslated returns true if the process runs with rosetta.
+func isTranslated() bool {
+	translated, err := syscall.SysctlUint32("sysctl.proc_translated")
+	return err == nil && translated == 1
+}
@@ -0,0 +1,15 @@
+//go:build !darwin
+
+package models
+
+import "errors"
+
+// getMacOSVersion is only available on macOS.
+func getMacOSVersion() (string, error) {
+	return "", errors.New("not macOS")
+}
+
+// isTranslated is only possible on macOS.
+func isTranslated() bool {
+	return false
+}
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestGetArch(t *testing.T) {
+	tests := []struct {
+		name       string
+		goarch     string
+		translated bool
+		want       string
+	}{
+		{"apple silicon", "arm64", false, Arm64},
+		{"intel", "amd64", false, X86_64},
+		// an intel binary under rosetta, the bottles of brew are still arm64.
+		{"rosetta", "amd64", true, Arm64},
+		{"unsupported", "386", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getArch(tt.goarch, func() bool { return tt.translated })
+
+			if len(tt.want) == 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("arch is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultBaseURL is the registry where homebrew publishes the bottles and their manifests.
+const DefaultBaseURL = "https://ghcr.io"
+
+// Client sends requests to an OCI registry (ghcr.io by default).
+// It answers the `WWW-Authenticate` challenge of the registry with an anonymous pull token,
+// and caches the token per repository scope, example: repository:homebrew/core/libraw:pull
+type Client struct {
+	// baseURL is the scheme and host of the registry, example: https://ghcr.io
+	// requests to DefaultBaseURL are sent here instead, so that a stand-in registry can be used.
+	baseURL string
+
+	httpClient *http.Client
+
+	// key string: scope, value: token
+	tokens map[string]string
+
+	// lock is used to make the tokens map thread-safe
+	lock *sync.RWMutex
+}
+
+// tokenResponse is the response of the token endpoint (the `realm` of the challenge).
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// New returns a new Client instance.
+// baseURL defaults to DefaultBaseURL when it's empty.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if len(baseURL) == 0 {
+		baseURL = DefaultBaseURL
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		tokens:     make(map[string]string),
+		lock:       &sync.RWMutex{},
+	}
+}
+
+// Get makes an authenticated GET request to the given URL.
+// accept is the `Accept` header, it's skipped when empty.
+func (c *Client) Get(rawURL string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+
+	return c.Do(req)
+}
+
+// Do sends the request with a cached token for its scope.
+// On a 401 the token is negotiated again from the challenge and the request is retried once.
+// The request must not have a body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.rewriteURL(req); err != nil {
+		return nil, err
+	}
+
+	scope := getScope(req.URL.Path)
+
+	if token := c.getToken(scope); len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	token, err := c.fetchToken(challenge, scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.setToken(scope, token)
+
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", "Bearer "+token)
+
+	return c.httpClient.Do(retry)
+}
+
+// rewriteURL points requests for DefaultBaseURL to the configured base url.
+func (c *Client) rewriteURL(req *http.Request) error {
+	if c.baseURL == DefaultBaseURL || !strings.HasPrefix(req.URL.String(), DefaultBaseURL+"/") {
+		return nil
+	}
+
+	u, err := url.Parse(c.baseURL + strings.TrimPrefix(req.URL.String(), DefaultBaseURL))
+
+	if err != nil {
+		return err
+	}
+
+	req.URL = u
+	req.Host = u.Host
+
+	return nil
+}
+
+// fetchToken requests an anonymous token from the realm of the challenge.
+// example challenge: Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:homebrew/core/libraw:pull"
+func (c *Client) fetchToken(challenge string, scope string) (string, error) {
+	params := parseChallenge(challenge)
+
+	realm, ok := params["realm"]
+
+	if !ok {
+		return "", fmt.Errorf("registry: no realm in challenge %q", challenge)
+	}
+
+	u, err := url.Parse(realm)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+
+	if s, ok := params["scope"]; ok {
+		scope = s
+	}
+
+	if len(scope) > 0 {
+		query.Set("scope", scope)
+	}
+
+	u.RawQuery = query.Encode()
+
+	resp, err := c.httpClient.Get(u.String())
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry: token request for %q failed with status code %d", scope, resp.StatusCode)
+	}
+
+	var data tokenResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+
+	if len(data.Token) > 0 {
+		return data.Token, nil
+	}
+
+	if len(data.AccessToken) > 0 {
+		return data.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("registry: empty token for %q", scope)
+}
+
+func (c *Client) getToken(scope string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.tokens[scope]
+}
+
+func (c *Client) setToken(scope string, token string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.tokens[scope] = token
+}
+
+// getScope returns the pull scope of the repository in the given path.
+// example: /v2/homebrew/core/libraw/manifests/0.21.1 => repository:homebrew/core/libraw:pull
+func getScope(path string) string {
+	path = strings.TrimPrefix(path, "/v2/")
+
+	for _, sep := range []string{"/manifests/", "/blobs/"} {
+		if i := strings.LastIndex(path, sep); i > 0 {
+			return fmt.Sprintf("repository:%s:pull", path[:i])
+		}
+	}
+
+	return ""
+}
+
+// parseChallenge parses the parameters of a `WWW-Authenticate: Bearer ...` header.
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+
+	challenge = strings.TrimSpace(challenge)
+
+	if len(challenge) < 7 || !strings.EqualFold(challenge[:7], "bearer ") {
+		return params
+	}
+
+	rest := challenge[7:]
+
+	for len(rest) > 0 {
+		eq := strings.IndexByte(rest, '=')
+
+		if eq < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+
+	return params
+}
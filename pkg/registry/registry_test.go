@@ -0,0 +1,222 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn is a local stand-in registry: the blobs and manifests need a bearer token of their scope,
+// issued anonymously by its /token endpoint.
+type standIn struct {
+	*httptest.Server
+
+	lock sync.Mutex
+
+	// key string: scope, value: number of tokens issued
+	issued map[string]int
+
+	// revoked makes the tokens issued so far invalid
+	revoked bool
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{issued: make(map[string]int)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("service") != "stand-in" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			scope := r.URL.Query().Get("scope")
+			s.issued[scope]++
+			fmt.Fprintf(w, `{"token":"%s#%d"}`, scope, s.issued[scope])
+			return
+		}
+
+		scope := getScope(r.URL.Path)
+		expected := fmt.Sprintf("Bearer %s#%d", scope, s.issued[scope])
+
+		if s.revoked || s.issued[scope] == 0 || r.Header.Get("Authorization") != expected {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="stand-in",scope="%s"`, s.URL, scope))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprint(w, "content of "+r.URL.Path)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *standIn) getIssued(scope string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.issued[scope]
+}
+
+func get(t *testing.T, c *Client, url string) string {
+	t.Helper()
+
+	resp, err := c.Get(url, "")
+
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status code %d", url, resp.StatusCode)
+	}
+
+	return string(body)
+}
+
+func TestChallengeTokenRetry(t *testing.T) {
+	s := newStandIn(t)
+	c := New(s.URL, s.Client())
+
+	// requests to ghcr.io are sent to the stand-in registry.
+	body := get(t, c, DefaultBaseURL+"/v2/homebrew/core/libraw/manifests/0.21.1")
+
+	if body != "content of /v2/homebrew/core/libraw/manifests/0.21.1" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+
+	if n := s.getIssued("repository:homebrew/core/libraw:pull"); n != 1 {
+		t.Fatalf("expected 1 token, got %d", n)
+	}
+}
+
+func TestTokenCachedPerScope(t *testing.T) {
+	s := newStandIn(t)
+	c := New(s.URL, s.Client())
+
+	get(t, c, s.URL+"/v2/homebrew/core/libraw/manifests/0.21.1")
+	get(t, c, s.URL+"/v2/homebrew/core/libraw/blobs/sha256:abc")
+	get(t, c, s.URL+"/v2/homebrew/core/libraw/blobs/sha256:def")
+	get(t, c, s.URL+"/v2/homebrew/core/openssl/3/blobs/sha256:abc")
+
+	if n := s.getIssued("repository:homebrew/core/libraw:pull"); n != 1 {
+		t.Fatalf("expected 1 token for libraw, got %d", n)
+	}
+
+	if n := s.getIssued("repository:homebrew/core/openssl/3:pull"); n != 1 {
+		t.Fatalf("expected 1 token for openssl/3, got %d", n)
+	}
+}
+
+func TestExpiredTokenRenewed(t *testing.T) {
+	s := newStandIn(t)
+	c := New(s.URL, s.Client())
+
+	url := s.URL + "/v2/homebrew/core/libraw/blobs/sha256:abc"
+
+	get(t, c, url)
+
+	s.lock.Lock()
+	s.revoked = true
+	s.lock.Unlock()
+
+	resp, err := c.Get(url, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	// the renewed token is revoked too, the second 401 is returned as it is, without a loop.
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+
+	if n := s.getIssued("repository:homebrew/core/libraw:pull"); n != 2 {
+		t.Fatalf("expected 2 tokens, got %d", n)
+	}
+}
+
+func TestChallengeWithoutRealm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer service="ghcr.io"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, srv.Client()).Get(srv.URL+"/v2/a/b/blobs/sha256:abc", "")
+
+	if err == nil || !strings.Contains(err.Error(), "no realm") {
+		t.Fatalf("expected a no realm error, got %v", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		want      map[string]string
+	}{
+		{
+			`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:homebrew/core/libraw:pull"`,
+			map[string]string{"realm": "https://ghcr.io/token", "service": "ghcr.io", "scope": "repository:homebrew/core/libraw:pull"},
+		},
+		{
+			// a comma inside a quoted value
+			`Bearer realm="https://r/token",scope="repository:a/b:pull,push"`,
+			map[string]string{"realm": "https://r/token", "scope": "repository:a/b:pull,push"},
+		},
+		{
+			// case-insensitive scheme and keys, spaces, unquoted values
+			`  bearer Realm=https://r/token, Service=r  `,
+			map[string]string{"realm": "https://r/token", "service": "r"},
+		},
+		{
+			// an unterminated quote takes the rest
+			`Bearer realm="https://r/token`,
+			map[string]string{"realm": "https://r/token"},
+		},
+		{
+			// an empty value
+			`Bearer realm="",service=r`,
+			map[string]string{"realm": "", "service": "r"},
+		},
+		{`Basic realm="r"`, map[string]string{}},
+		{`Bearer`, map[string]string{}},
+		{``, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseChallenge(tt.challenge); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseChallenge(%q) = %v, want %v", tt.challenge, got, tt.want)
+		}
+	}
+}
+
+func TestGetScope(t *testing.T) {
+	tests := map[string]string{
+		"/v2/homebrew/core/libraw/manifests/0.21.1":  "repository:homebrew/core/libraw:pull",
+		"/v2/homebrew/core/openssl/3/blobs/sha256:a": "repository:homebrew/core/openssl/3:pull",
+		"/token": "",
+	}
+
+	for path, want := range tests {
+		if got := getScope(path); got != want {
+			t.Errorf("getScope(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Policy decides how many times and how long a failed network operation is retried.
+// The wait between the attempts grows exponentially with full jitter, starting from Backoff.
+type Policy struct {
+	// Attempts is the maximum number of attempts, the first one included.
+	// default is 4
+	Attempts int
+
+	// Backoff is the base wait before the second attempt.
+	// default is 500ms
+	Backoff time.Duration
+
+	// MaxBackoff caps the wait between two attempts.
+	// default is 30s
+	MaxBackoff time.Duration
+
+	// MaxElapsed stops retrying once the operation took this long, 0 means no limit.
+	// for RunResumable, it's the time since the last attempt that made progress.
+	// default is 2m
+	MaxElapsed time.Duration
+
+	// Timeout is the timeout of a single attempt of a small request, example: a formula json, 0 means no limit.
+	// not of the bottle downloads, they can take minutes.
+	// default is 10s
+	Timeout time.Duration
+}
+
+// StatusError is returned for an unexpected http status code.
+// 429 and 5xx status codes are retried.
+type StatusError struct {
+	StatusCode int
+	URL        string
+
+	// RetryAfter is the wait asked by the server with the `Retry-After` header.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d for %s", e.StatusCode, e.URL)
+}
+
+// DefaultPolicy returns the policy used when no flags are given.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Attempts:   4,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+		MaxElapsed: 2 * time.Minute,
+		Timeout:    10 * time.Second,
+	}
+}
+
+// NewStatusError returns a StatusError for the given response.
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		URL:        resp.Request.URL.String(),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// Run calls fn until it succeeds, returns an error that isn't retryable, or the policy gives up.
+// The last error is returned.
+func (p *Policy) Run(fn func() error) error {
+	return p.RunResumable(func() (bool, error) {
+		return false, fn()
+	})
+}
+
+// RunResumable is Run for an operation resuming the work of its previous attempts, example: a bottle download.
+// fn returns true if its attempt made progress, then the elapsed time (MaxElapsed) and the attempts start over,
+// so that a long download is retried as long as it keeps going forward.
+func (p *Policy) RunResumable(fn func() (bool, error)) error {
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		progressed, err := fn()
+
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+
+		if progressed {
+			start = time.Now()
+			attempt = 1
+		}
+
+		if attempt >= p.Attempts {
+			return err
+		}
+
+		wait := p.getWait(attempt, err)
+
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return err
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// getWait returns the wait after the given attempt, honoring the `Retry-After` of the server.
+func (p *Policy) getWait(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+
+	wait := p.Backoff << (attempt - 1)
+
+	if wait <= 0 || (p.MaxBackoff > 0 && wait > p.MaxBackoff) {
+		wait = p.MaxBackoff
+	}
+
+	if wait <= 0 {
+		return 0
+	}
+
+	// full jitter
+	return time.Duration(rand.Int63n(int64(wait)) + 1)
+}
+
+// IsRetryable returns true for errors worth another attempt:
+// 429 and 5xx status codes, timeouts, connection resets and truncated bodies.
+func IsRetryable(err error) bool {
+	var statusErr *StatusError
+
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.StatusCode)
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	// not every net.Error, a *url.Error is one too, example: "no such host"
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses the `Retry-After` header, either in seconds or as a http date.
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
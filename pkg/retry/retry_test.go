@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunResumableRestartsOnProgress(t *testing.T) {
+	p := &Policy{Attempts: 2, MaxElapsed: 50 * time.Millisecond}
+
+	attempts := 0
+
+	// every attempt makes progress and takes longer than MaxElapsed, it's still retried until it succeeds.
+	err := p.RunResumable(func() (bool, error) {
+		attempts++
+		time.Sleep(60 * time.Millisecond)
+
+		if attempts < 5 {
+			return true, io.ErrUnexpectedEOF
+		}
+
+		return true, nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if attempts != 5 {
+		t.Fatalf("expected 5 attempts, got %d", attempts)
+	}
+}
+
+func TestRunResumableGivesUpWithoutProgress(t *testing.T) {
+	p := &Policy{Attempts: 3}
+
+	attempts := 0
+
+	err := p.RunResumable(func() (bool, error) {
+		attempts++
+		return false, io.ErrUnexpectedEOF
+	})
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no such host", &url.Error{Op: "Get", URL: "https://nope.invalid", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}}, false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://x", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+		{"timeout", &url.Error{Op: "Get", URL: "https://x", Err: timeoutError{}}, true},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://x", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"truncated body", io.ErrUnexpectedEOF, true},
+		{"503", &StatusError{StatusCode: 503}, true},
+		{"404", &StatusError{StatusCode: 404}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
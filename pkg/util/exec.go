@@ -39,8 +39,17 @@ func Exec(cmd string, args ...string) (string, error) {
 
 // ExecStandard executes the given command and prints the output to stdout and stderr.
 func ExecStandard(cmd string, args ...string) error {
+	return ExecStandardWithEnv(nil, cmd, args...)
+}
+
+// ExecStandardWithEnv is ExecStandard with extra environment variables.
+func ExecStandardWithEnv(env []string, cmd string, args ...string) error {
 	c := exec.Command(cmd, args...)
 
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 
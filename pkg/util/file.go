@@ -3,6 +3,7 @@ package util
 import (
 	"io"
 	"os"
+	"path/filepath"
 )
 
 // DoesFileExist returns true if the file exists
@@ -10,7 +11,8 @@ import (
 func DoesFileExist(path string) bool {
 	info, err := os.Stat(path)
 
-	if os.IsNotExist(err) {
+	// not only a missing file, example: a path under a file
+	if err != nil {
 		return false
 	}
 
@@ -21,7 +23,7 @@ func DoesFileExist(path string) bool {
 func DoesDirExist(path string) bool {
 	info, err := os.Stat(path)
 
-	if os.IsNotExist(err) {
+	if err != nil {
 		return false
 	}
 
@@ -39,20 +41,63 @@ func CreateDirIfNotExists(path string) error {
 
 // WriteFile writes the given io.Reader to the given path.
 // and it overwrites the file if it already exists.
+// The content is written to IncompletePath(path) first and only moved to the path once it's complete,
+// so that a partial file is never left at the path.
 func WriteFile(path string, reader io.Reader) error {
-	var file, err = os.Create(path)
+	incomplete := IncompletePath(path)
 
-	if err != nil {
+	if err := AppendFile(incomplete, reader, false); err != nil {
+		os.Remove(incomplete)
 		return err
 	}
 
-	defer file.Close()
+	return os.Rename(incomplete, path)
+}
 
-	_, err = io.Copy(file, reader)
+// AppendFile writes the given io.Reader to the end of the file at the given path.
+// the file is truncated first if resume is false.
+func AppendFile(path string, reader io.Reader, resume bool) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = io.Copy(file, reader)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// IncompletePath returns the path of the partial file of the given path, the same way brew names them.
+// example: $HOMEBREW_DOWNLOADS_DIR/{sha}--luajit--2.1.0.ventura.bottle.tar.gz.incomplete
+func IncompletePath(path string) string {
+	return path + ".incomplete"
+}
+
+// CreateSymlink creates a symlink at the given path pointing to target.
+// an existing file or symlink at the path is replaced.
+// the target is made relative to the symlink's directory, the way brew links its cache,
+// so that the cache still works after being copied somewhere else.
+func CreateSymlink(target string, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if rel, err := filepath.Rel(filepath.Dir(path), target); err == nil {
+		target = rel
+	}
+
+	return os.Symlink(target, path)
 }
@@ -1,7 +1,25 @@
 package util
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strings"
+)
 
 func GetFormulaURL(name string) string {
-	return fmt.Sprintf("https://formulae.brew.sh/api/formula/%s.json", name)
+	return fmt.Sprintf("%s/formula/%s.json", getAPIDomain(), name)
+}
+
+func GetFormulaIndexURL() string {
+	return getAPIDomain() + "/formula.json"
+}
+
+// getAPIDomain returns the base url of the Homebrew JSON API, HOMEBREW_API_DOMAIN if it's set (the same as brew).
+// example: https://formulae.brew.sh/api, or a mirror
+func getAPIDomain() string {
+	if domain := os.Getenv("HOMEBREW_API_DOMAIN"); len(domain) > 0 {
+		return strings.TrimSuffix(domain, "/")
+	}
+
+	return "https://formulae.brew.sh/api"
 }
@@ -3,7 +3,9 @@ package util
 import (
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -35,3 +37,22 @@ func RandomString(length int) string {
 
 	return string(b)
 }
+
+// Sha256File returns the hex encoded sha256 of the file at the given path.
+func Sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}